@@ -3,17 +3,29 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"go/ast"
 	"go/format"
 	"go/parser"
 	"go/token"
+	"io"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+
+	"go-sort/gosort"
 )
 
 // sort a go file,
@@ -26,25 +38,648 @@ import (
 //go:generate go mod tidy
 //go:generate go install -v -trimpath -ldflags "-s -w" go-sort.go
 func main() {
-	if e := sortFile(); e != nil {
+	flag.Parse()
+	if *versionFlag || (flag.NArg() == 1 && flag.Arg(0) == "version") {
+		fmt.Print(versionInfo())
+		return
+	}
+	if e := loadConfig(*configFlag); e != nil {
+		log.Fatalln(e)
+	}
+	sorter, e := gosort.NewSorter(flagOptions())
+	if e != nil {
+		log.Fatalln(e)
+	}
+	needSort, e := sortFile(sorter)
+	if e != nil {
 		log.Fatalln(e)
 	}
+	if shouldFail(needSort) {
+		os.Exit(1)
+	}
 }
 
-// letterDecl is a letter and its declaration
-type letterDecl struct {
-	Letter string
-	Decl   ast.Decl
+// init registers the flags that can't be declared by a single call
+func init() {
+	flag.Var(&excludeFlag, "exclude", "glob pattern of the paths or base names of the files and directories to skip, repeatable, e.g. -exclude vendor -exclude '*_gen.go'")
 }
 
-// letterDeclList is a list of letterDecl
-type letterDeclList []letterDecl
+// defaultConfigFile is loaded from the working directory if it exists
+const defaultConfigFile = ".go-sort.json"
+
+// anchorFlag is the text of the comments declarations never cross
+var anchorFlag = flag.String("anchor", "", "floating comments containing this text keep their place, declarations are sorted between them without crossing them, ignored with a public marker")
+
+// associateFuncsFlag lists the patterns of the free functions written with a type
+var associateFuncsFlag = flag.String("associate-funcs", "", "comma separated glob patterns where {type} stands for a type name, e.g. New{type},Parse{type},{type}From*, matching functions are written after the methods of the type")
+
+// betweenFlag sorts the go sources between two markers of a text file
+var betweenFlag = flag.String("between", "", "sort only the go sources found between the `START,END` markers, e.g. \"```go,```\", the text around them is kept as is")
+
+// blankDeclsFlag places the declarations of the blank identifier in their section
+var blankDeclsFlag = flag.String("blank-decls", "", "place the declarations of the blank identifier, e.g. var _ Interface = (*T)(nil): bottom of their section or their source place, sorted as _ when empty")
+
+// checkFlag reports unsorted files instead of rewriting them
+var checkFlag = flag.Bool("check", false, "report files that need reordering or reformatting, exit 1 if any")
+
+// ciFlag sorts names case-insensitively
+var ciFlag = flag.Bool("ci", false, "compare names case-insensitively, exported names still come first and equal names are ordered by their bytes")
+
+// collateFlag sorts names with the collation of a locale instead of their bytes
+var collateFlag = flag.String("collate", "", "sort names with the unicode collation of this locale, e.g. und, fr, de")
+
+// conf is the configuration loaded from the config file
+var conf = new(config)
+
+// configFlag is the path of the config file
+var configFlag = flag.String("config", defaultConfigFile, "path of the json config file")
+
+// diffContextFlag is the number of unchanged lines around every change printed by -d
+var diffContextFlag = flag.Int("diff-context", 3, "number of context lines around every change printed by -d, like diff -U")
+
+// diffExitCodeFlag prints the diff like -d and fails when a file would change
+var diffExitCodeFlag = flag.Bool("diff-exit-code", false, "print a unified diff of the sorted files like -d, exit 1 if any file would change, for CI")
+
+// diffFlag prints a unified diff of the sorted files instead of rewriting them, like gofmt -d
+var diffFlag = flag.Bool("d", false, "print a unified diff of the sorted files instead of rewriting them, the exit code is 0 whether files differ or not")
+
+// diffFormatFlag prints the moved declarations in the given format instead of rewriting files
+var diffFormatFlag = flag.String("diff-format", "", "print the reordering instead of rewriting files, supported: json")
+
+// diffScopeFlag is a unified diff, only the declarations it touches are checked against their neighbors
+var diffScopeFlag = flag.String("diff-scope", "", "read a unified diff from this file, - for the standard input, e.g. git diff -U0 | go-sort -diff-scope -, report the changed declarations out of order with their neighbors and exit 1 if any, without writing")
+
+// dryRunFlag prints the files that would be written instead of writing them
+var dryRunFlag = flag.Bool("dry-run", false, "print the files that would be written, with -out-dir the destination paths, without writing them")
+
+// enforceFlag lists the sections whose order is enforced
+var enforceFlag = flag.String("enforce", "", "comma separated sections (const, var, type, func) whose declarations are sorted and checked, the other sections keep their source order, methods belong to the type section")
+
+// enumClusterFlag writes the String method of an enum type after its const block
+var enumClusterFlag = flag.Bool("enum-cluster", false, "write the String method of a type, with the consts and vars it uses, right after the first const block of the type")
+
+// errorsWithTypeFlag writes the error sentinels of a type right after it
+var errorsWithTypeFlag = flag.Bool("errors-with-type", false, "write the error sentinel vars of a type, e.g. ErrServerClosed for Server, right after the type, see error_patterns in the config file")
+
+// excludeFlag lists the patterns of the files and directories never sorted
+var excludeFlag patternList
+
+// exportFirstFlag limits the kinds sorting exported names before unexported ones
+var exportFirstFlag = flag.String("export-first", "", "comma separated kinds (const, var, type, func, method) where exported names come first, the other kinds are sorted case-insensitively, all kinds keep exported names first by default")
+
+// failFastFlag stops a run at the first file that fails to sort
+var failFastFlag = flag.Bool("fail-fast", false, "stop at the first file that fails to sort, by default every file is attempted and the failures are reported at the end")
+
+// firstFlag overrides the priority patterns of the config file
+var firstFlag = flag.String("first", "", "comma separated names or glob patterns written first in every section, e.g. New*,Must* or a registry var, a const or var block matches by any of its names")
+
+// groupFuncVarsFlag writes the function typed vars as a block of their own
+var groupFuncVarsFlag = flag.Bool("group-func-vars", false, "write the vars of function type, e.g. var OnError func(error), as a block of their own after the other vars")
+
+// groupImportsFlag splits the import blocks into standard library, third-party and local groups
+var groupImportsFlag = flag.Bool("group-imports", false, "split import blocks into standard library, third-party and local imports (see -local, the module of the nearest go.mod by default), separated by a blank line")
+
+// groupOrphanMethodsFlag groups the methods of the types of other files by receiver
+var groupOrphanMethodsFlag = flag.Bool("group-orphan-methods", false, "write the methods whose type is declared in another file after the functions, grouped by receiver type")
+
+// helpersAfterCallersFlag writes the helpers of a single exported function right after it
+var helpersAfterCallersFlag = flag.Bool("helpers-after-callers", false, "write an unexported function used by a single exported function, and nowhere else in the file, right after that function")
+
+// impactFlag prints a repository level summary of the changes instead of writing
+var impactFlag = flag.Bool("impact", false, "print the number of files changed and declarations moved, without writing")
+
+// implMethodsFirstFlag names the interface whose methods come first in its implementations
+var implMethodsFirstFlag = flag.String("impl-methods-first", "", "write the methods of the types implementing this interface of the file first, in the order of the interface")
+
+// includeGeneratedFlag sorts generated files too
+var includeGeneratedFlag = flag.Bool("include-generated", false, "also sort the files with a \"// Code generated ... DO NOT EDIT.\" comment, they are skipped by default")
+
+// jobsFlag is the number of files sorted at the same time
+var jobsFlag = flag.Int("j", runtime.GOMAXPROCS(0), "number of files sorted at the same time")
+
+// keepBlankLinesFlag carries the blank lines above each declaration with it
+var keepBlankLinesFlag = flag.Bool("keep-blank-lines", false, "keep the blank lines above each declaration in the source, so declarations of a section stay visually grouped")
+
+// keepValueRunsFlag keeps documented runs of adjacent const and var declarations together
+var keepValueRunsFlag = flag.Bool("keep-value-runs", false, "keep a documented run of adjacent const and var declarations together in the const section")
+
+// listFlag lists the files whose sorted content differs instead of rewriting them, like gofmt -l
+var listFlag = flag.Bool("l", false, "list the files whose sorted content differs from the current one, without writing, exit 1 if any")
+
+// localFlag is the import path prefix of the local imports, it enables -group-imports
+var localFlag = flag.String("local", "", "group the imports starting with this prefix after the third-party ones, e.g. github.com/org/project, implies -group-imports")
+
+// mainFirstFlag writes func main before init functions
+var mainFirstFlag = flag.Bool("main-first", false, "always write func main first, right after the package clause, imports and file comments")
+
+// manifestFlag is a build manifest listing the files to sort
+var manifestFlag = flag.String("manifest", "", "sort exactly the files listed by this json manifest, {\"files\": [...]} or [...]")
+
+// markerFlag adds the sorted marker comment at the top or at the bottom of the file
+var markerFlag = flag.String("marker", "", "ensure a \""+gosort.SortedMarker+"\" comment at the top or the bottom of the file, supported: top, bottom")
+
+// methodSortFlag is the order of the methods of a type
+var methodSortFlag = flag.String("method-sort", "", "order of the methods of a type, supported: name, arity (fewer parameters first, then by name)")
+
+// modulePaths caches the module path of the directories, see getModulePath
+var modulePaths sync.Map
+
+// noopFlag prints what would be done with every file without doing it
+var noopFlag = flag.Bool("n", false, "print for every file whether it would be sorted or is already sorted, without writing")
+
+// nulFlag separates the -l paths by NUL bytes
+var nulFlag = flag.Bool("0", false, "separate the paths printed by -l with NUL bytes instead of newlines, for xargs -0")
+
+// onlyMethodsOfFlag sorts the methods of one type and leaves everything else in source order
+var onlyMethodsOfFlag = flag.String("only-methods-of", "", "only sort the methods of this type, everything else keeps its source order")
+
+// outDirFlag mirrors the sorted files into a directory instead of rewriting them in place
+var outDirFlag = flag.String("out-dir", "", "write the sorted files into this directory, keeping their path relative to the sorted root")
+
+// outModeFlag is the mode of the files written into -out-dir
+var outModeFlag = flag.String("out-mode", "", "octal permissions of the files written into -out-dir, e.g. 0644, the permissions of the sorted file by default")
+
+// preserveOrderForFlag lists declarations keeping their relative source order
+var preserveOrderForFlag = flag.String("preserve-order-for", "", "comma separated names or glob patterns whose declarations keep their relative source order")
+
+// protectVendorFlag fails the run when a target is a vendored file
+var protectVendorFlag = flag.Bool("protect-vendor", false, "fail without sorting anything if a target resolves inside a vendor directory")
+
+// reportCommentsFlag lists the floating comments a sort would relocate instead of sorting
+var reportCommentsFlag = flag.Bool("report-comments", false, "list the comments outside of declarations that the sort would move between other declarations, without writing")
+
+// requireDocFlag reports the exported declarations without a doc comment instead of writing
+var requireDocFlag = flag.Bool("require-doc", false, "report the exported declarations without a doc comment and exit 1 if any, without writing")
+
+// resultsFlag is the json file the status of every file is written to
+var resultsFlag = flag.String("results", "", "also write the status (file, status, reason) of every file to this json file, e.g. with -check in CI")
+
+// safeFlag verifies that no declaration was dropped or duplicated before writing
+var safeFlag = flag.Bool("safe", false, "abort and keep the original file if the sorted declarations differ from the original ones, a struct with reordered fields included")
+
+// separateMethodsFlag writes the methods among the functions
+var separateMethodsFlag = flag.Bool("separate-methods", false, "write the methods sorted among the functions instead of right after their type")
 
-func (l letterDeclList) Len() int { return len(l) }
+// serializeWritesFlag funnels all file writes through a single goroutine
+var serializeWritesFlag = flag.Bool("serialize-writes", false, "write files one at a time from a single goroutine, for filesystems that misbehave under concurrent writes")
 
-func (l letterDeclList) Less(i, j int) bool { return l[i].Letter < l[j].Letter }
+// sortInterfacesFlag sorts the methods of interfaces by name
+var sortInterfacesFlag = flag.Bool("sort-interfaces", false, "sort the methods of interfaces by name, constraint interfaces are kept as is")
+
+// sortStructFieldsFlag sorts the fields of structs by name
+var sortStructFieldsFlag = flag.Bool("sort-struct-fields", false, "sort the fields of structs by name, exported fields first, a struct marked //go-sort:no-field-sort or used in an unkeyed composite literal of its package is kept as is, the field order is part of the type identity, -safe refuses a reordered struct")
+
+// sortWithinBlocksFlag sorts the specs of const and var blocks
+var sortWithinBlocksFlag = flag.Bool("sort-within-blocks", false, "sort the specs of parenthesized const and var blocks by name, blocks using iota are kept as is")
+
+// stdinFilenameFlag is the file name used when sorting the standard input
+var stdinFilenameFlag = flag.String("stdin-filename", "", "sort the standard input to the standard output, using this file name in errors")
+
+// stdoutFlag prints the sorted files instead of rewriting them
+var stdoutFlag = flag.Bool("stdout", false, "print the sorted files to the standard output instead of rewriting them")
+
+// stripPrefixFlag lists prefixes ignored when sorting names
+var stripPrefixFlag = flag.String("strip-prefix", "", "comma separated name prefixes ignored when sorting, e.g. Handle sorts HandleLogin as Login")
+
+// stripSuffixFlag lists suffixes ignored when sorting names
+var stripSuffixFlag = flag.String("strip-suffix", "", "comma separated name suffixes ignored when sorting")
+
+// stripWSFlag trims trailing whitespace of the sorted output
+var stripWSFlag = flag.Bool("strip-ws", false, "trim trailing whitespace from every output line")
+
+// testsMatchSourceFlag sorts the test files of the walked directories, their tests ordered like the declarations they test
+var testsMatchSourceFlag = flag.Bool("tests-match-source", false, "sort the test files too, in a foo_test.go file, order the tests, benchmarks and examples like the sorted declarations of foo.go they test, e.g. TestFoo at the place of Foo")
+
+// verifyFlag checks that sorting is idempotent instead of writing
+var verifyFlag = flag.Bool("verify", false, "sort every file twice in memory and exit 1 if the second sort differs from the first")
+
+// versionFlag prints the version and build info
+var versionFlag = flag.Bool("version", false, "print the version, the go version and the vcs build info, also go-sort version")
+
+// writeQueue is the queue of the single writer goroutine used by -serialize-writes
+var writeQueue chan writeRequest
+
+// writeQueueOnce starts the writer goroutine
+var writeQueueOnce sync.Once
+
+// commentMove is a floating comment written between other declarations by the sort
+type commentMove struct {
+	// Text is the first line of the comment
+	Text string
+	// FromLine and ToLine are the lines of the comment in the original and the sorted content
+	FromLine, ToLine int
+}
+
+// config is the json config file of go-sort
+type config struct {
+	// ErrorPatterns lists the glob patterns of the error sentinels written with a type by -errors-with-type
+	ErrorPatterns []string `json:"error_patterns"`
+	// IncludeDirs limits processing to these directories, relative to the config file
+	IncludeDirs []string `json:"include_dirs"`
+	// Priority lists names or glob patterns written first in every section, in this order
+	Priority []string `json:"priority"`
+}
+
+// included reports whether path is inside an included directory,
+// a directory is also included if it is an ancestor of an included directory, so the walk can reach it
+func (c *config) included(path string, isDir bool) bool {
+	if len(c.IncludeDirs) == 0 {
+		return true
+	}
+	path, e := filepath.Abs(path)
+	if e != nil {
+		return false
+	}
+	sep := string(filepath.Separator)
+	for _, dir := range c.IncludeDirs {
+		if path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, sep)+sep) {
+			return true
+		}
+		if isDir && strings.HasPrefix(dir, strings.TrimSuffix(path, sep)+sep) {
+			return true
+		}
+	}
+	return false
+}
+
+// declMove is a declaration moved by the sort
+type declMove struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	FromIndex int    `json:"fromIndex"`
+	ToIndex   int    `json:"toIndex"`
+}
+
+// fileMoves is the json report of the declarations moved in a file
+type fileMoves struct {
+	File  string     `json:"file"`
+	Moves []declMove `json:"moves"`
+}
+
+// fileResult is the json result of a file written by -results
+type fileResult struct {
+	File string `json:"file"`
+	// Status is sorted, unsorted, skipped or error, the reason of an error is its text
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// manifest lists the source files of a build system target
+type manifest struct {
+	Files []string `json:"files"`
+}
+
+// patternList is a flag repeated once per pattern
+type patternList []string
+
+// Set adds a pattern, it is checked by filepath.Match so a malformed one is reported at once
+func (p *patternList) Set(value string) error {
+	if _, err := filepath.Match(value, ""); err != nil {
+		return fmt.Errorf("malformed pattern %s: %w", value, err)
+	}
+	*p = append(*p, value)
+	return nil
+}
+
+func (p *patternList) String() string { return strings.Join(*p, ",") }
+
+// repoImpact summarizes the changes a sort would make across all files
+type repoImpact struct {
+	Files        int
+	ChangedFiles int
+	MovedDecls   int
+	LargestFile  string
+	LargestMoves int
+}
+
+func (r *repoImpact) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "files checked: %d\n", r.Files)
+	fmt.Fprintf(&b, "files changed: %d\n", r.ChangedFiles)
+	fmt.Fprintf(&b, "declarations moved: %d\n", r.MovedDecls)
+	if r.LargestFile != "" {
+		fmt.Fprintf(&b, "largest diff: %s (%d declarations moved)\n", r.LargestFile, r.LargestMoves)
+	}
+	return b.String()
+}
+
+func (r *repoImpact) add(file string, res sortResult) {
+	r.Files++
+	if res.changed() {
+		r.ChangedFiles++
+	}
+	r.MovedDecls += len(res.Moves)
+	if len(res.Moves) > r.LargestMoves {
+		r.LargestFile, r.LargestMoves = file, len(res.Moves)
+	}
+}
+
+// sortJob is the outcome of sorting a target file
+type sortJob struct {
+	res sortResult
+	err error
+	// output is what was printed for the file
+	output bytes.Buffer
+	// done is false for a target cancelled by -fail-fast
+	done bool
+}
+
+// sortResult describes how the sorted content differs from the original
+type sortResult struct {
+	// Generated is true if the file was skipped as generated, see -include-generated
+	Generated bool
+	// Reordered is true if the declaration sequence changed
+	Reordered bool
+	// Reformatted is true if the original content is not gofmt-clean
+	Reformatted bool
+	// Other is true if the content changed in any other way, e.g. moved comments
+	Other bool
+	// Moves lists the declarations whose index changed
+	Moves []declMove
+}
+
+func (r sortResult) String() string {
+	var reasons []string
+	if r.Reordered {
+		reasons = append(reasons, "needs reordering")
+	}
+	if r.Reformatted {
+		reasons = append(reasons, "needs formatting")
+	}
+	if r.Other {
+		reasons = append(reasons, "needs comment or spacing changes")
+	}
+	return strings.Join(reasons, ", ")
+}
 
-func (l letterDeclList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (r sortResult) changed() bool { return r.Reordered || r.Reformatted || r.Other }
+
+// targetFile is a go file to sort and the path it was found from
+type targetFile struct {
+	Root string
+	File string
+}
+
+// writeRequest is a file write sent to the writer goroutine
+type writeRequest struct {
+	filename string
+	data     []byte
+	perm     os.FileMode
+	done     chan error
+}
+
+// checkDiffScope reports the declarations touched by a unified diff that are out of order with their neighbors,
+// the rest of the files is never checked, so a file can be adopted progressively,
+// the files of the diff are selected like the files of a walk, see isDiffTarget
+func checkDiffScope(sorter *gosort.Sorter, diffFile string) (failed bool, err error) {
+	var diff []byte
+	if diffFile == "-" {
+		diff, err = io.ReadAll(os.Stdin)
+	} else {
+		diff, err = os.ReadFile(diffFile)
+	}
+	if err != nil {
+		return
+	}
+	changes := parseDiffLines(diff)
+	files := make([]string, 0, len(changes))
+	for file := range changes {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		if !strings.HasSuffix(file, ".go") || !isDiffTarget(file) {
+			continue
+		}
+		if *protectVendorFlag && isVendorPath(".", file) {
+			return failed, fmt.Errorf("%s is vendored, refusing to check it with -protect-vendor", file)
+		}
+		content, e := os.ReadFile(file)
+		if errors.Is(e, fs.ErrNotExist) {
+			//deleted by the diff
+			continue
+		}
+		if e != nil {
+			return failed, e
+		}
+		if !*includeGeneratedFlag && isGenerated(file, content) {
+			continue
+		}
+		disorders, e := sorter.OutOfOrder(file, content, func(start, end int) bool {
+			for _, lines := range changes[file] {
+				if lines[0] <= end && lines[1] >= start {
+					return true
+				}
+			}
+			return false
+		})
+		if e != nil {
+			return failed, e
+		}
+		for _, disorder := range disorders {
+			failed = true
+			fmt.Printf("%s: %s is out of order with %s\n", disorder.Position, disorder.Name, disorder.Neighbor)
+		}
+	}
+	return
+}
+
+// commentMoves returns the floating comments, outside of every declaration and its doc, whose neighbor declarations
+// differ between the original and the sorted content, comments are matched by their text in source order
+func commentMoves(filename string, content, out []byte) (moves []commentMove, err error) {
+	type floating struct {
+		text   string
+		line   int
+		around [2]string
+	}
+	collect := func(src []byte) (list []floating, err error) {
+		fSet := token.NewFileSet()
+		f, err := parser.ParseFile(fSet, filename, src, parser.ParseComments)
+		if err != nil {
+			return
+		}
+		for _, commentGroup := range f.Comments {
+			if commentGroup.Pos() < f.Package {
+				continue
+			}
+			var around [2]string
+			inside := false
+			for _, decl := range f.Decls {
+				start := decl.Pos()
+				switch _decl := decl.(type) {
+				case *ast.GenDecl:
+					if _decl.Doc != nil {
+						start = _decl.Doc.Pos()
+					}
+				case *ast.FuncDecl:
+					if _decl.Doc != nil {
+						start = _decl.Doc.Pos()
+					}
+				}
+				if start <= commentGroup.Pos() && commentGroup.End() <= decl.End() {
+					inside = true
+					break
+				}
+				if decl.End() <= commentGroup.Pos() {
+					around[0] = declKey(decl)
+				} else if around[1] == "" {
+					around[1] = declKey(decl)
+				}
+			}
+			if !inside {
+				text, _, _ := strings.Cut(commentGroup.List[0].Text, "\n")
+				list = append(list, floating{text: text, line: fSet.Position(commentGroup.Pos()).Line, around: around})
+			}
+		}
+		return
+	}
+	before, err := collect(content)
+	if err != nil {
+		return
+	}
+	after, err := collect(out)
+	if err != nil {
+		return
+	}
+	for _, comment := range before {
+		i := slices.IndexFunc(after, func(other floating) bool { return other.text == comment.text })
+		if i < 0 {
+			continue
+		}
+		if after[i].around != comment.around {
+			moves = append(moves, commentMove{Text: comment.text, FromLine: comment.line, ToLine: after[i].line})
+		}
+		after = slices.Delete(after, i, i+1)
+	}
+	return
+}
+
+// compareSource compares the original and sorted content of a file,
+// a reorder is a change of the declaration sequence, a reformat is any change gofmt alone would make
+func compareSource(filename string, content, out []byte) (res sortResult, err error) {
+	fSet := token.NewFileSet()
+	src, err := parser.ParseFile(fSet, filename, content, parser.ParseComments)
+	if err != nil {
+		return
+	}
+	dst, err := parser.ParseFile(fSet, filename, out, parser.ParseComments)
+	if err != nil {
+		return
+	}
+	res.Reordered = !slices.Equal(declKeys(src), declKeys(dst))
+	res.Moves = declMoves(src, dst)
+	formatted, err := format.Source(content)
+	if err != nil {
+		return
+	}
+	res.Reformatted = !bytes.Equal(formatted, content)
+	res.Other = !res.Reordered && !res.Reformatted && !bytes.Equal(content, out)
+	return
+}
+
+// declKey returns a key identifying a declaration regardless of its position
+func declKey(decl ast.Decl) string {
+	kind, name := gosort.DeclKindName(decl)
+	return kind + " " + name
+}
+
+// declKeys returns the keys of all declarations of a file in source order
+func declKeys(f *ast.File) []string {
+	keys := make([]string, 0, len(f.Decls))
+	for _, decl := range f.Decls {
+		keys = append(keys, declKey(decl))
+	}
+	return keys
+}
+
+// declMoves returns the declarations whose index changed from src to dst,
+// declarations sharing a key are matched in source order
+func declMoves(src, dst *ast.File) []declMove {
+	toIndex := make(map[string][]int)
+	for i, decl := range dst.Decls {
+		key := declKey(decl)
+		toIndex[key] = append(toIndex[key], i)
+	}
+	var moves []declMove
+	for i, decl := range src.Decls {
+		key := declKey(decl)
+		if len(toIndex[key]) == 0 {
+			continue
+		}
+		to := toIndex[key][0]
+		toIndex[key] = toIndex[key][1:]
+		if to == i {
+			continue
+		}
+		kind, name := gosort.DeclKindName(decl)
+		moves = append(moves, declMove{Name: name, Kind: kind, FromIndex: i, ToIndex: to})
+	}
+	return moves
+}
+
+// flagOptions returns the options set by the command line flags and the config file
+func flagOptions() gosort.Options {
+	opts := gosort.Options{
+		Anchor:              *anchorFlag,
+		AssociateFuncs:      splitList(*associateFuncsFlag),
+		BlankDecls:          *blankDeclsFlag,
+		CaseInsensitive:     *ciFlag,
+		Collate:             *collateFlag,
+		Enforce:             splitList(*enforceFlag),
+		EnumCluster:         *enumClusterFlag,
+		ErrorPatterns:       conf.ErrorPatterns,
+		ErrorsWithType:      *errorsWithTypeFlag,
+		ExportFirst:         splitList(*exportFirstFlag),
+		GroupFuncVars:       *groupFuncVarsFlag,
+		GroupImports:        *groupImportsFlag || *localFlag != "",
+		GroupOrphanMethods:  *groupOrphanMethodsFlag,
+		HelpersAfterCallers: *helpersAfterCallersFlag,
+		ImplMethodsFirst:    *implMethodsFirstFlag,
+		KeepBlankLines:      *keepBlankLinesFlag,
+		KeepValueRuns:       *keepValueRunsFlag,
+		LocalPrefix:         *localFlag,
+		MainFirst:           *mainFirstFlag,
+		Marker:              *markerFlag,
+		MethodSort:          *methodSortFlag,
+		OnlyMethodsOf:       *onlyMethodsOfFlag,
+		PreserveOrderFor:    splitList(*preserveOrderForFlag),
+		Priority:            conf.Priority,
+		SeparateMethods:     *separateMethodsFlag,
+		SortInterfaces:      *sortInterfacesFlag,
+		SortStructFields:    *sortStructFieldsFlag,
+		SortWithinBlocks:    *sortWithinBlocksFlag,
+		StripPrefix:         splitList(*stripPrefixFlag),
+		StripSuffix:         splitList(*stripSuffixFlag),
+		StripWS:             *stripWSFlag,
+		Warnf:               log.Printf,
+	}
+	if *firstFlag != "" {
+		opts.Priority = splitList(*firstFlag)
+	}
+	return opts
+}
+
+// forPackage returns the sorter for a file with the other .go files of its directory, the files of its package
+func forPackage(sorter *gosort.Sorter, filename string) (*gosort.Sorter, error) {
+	dir := filepath.Dir(filename)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	for _, entry := range entries {
+		name := filepath.Join(dir, entry.Name())
+		if entry.IsDir() || filepath.Ext(name) != ".go" || name == filepath.Clean(filename) {
+			continue
+		}
+		content, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = content
+	}
+	return sorter.ForPackage(files)
+}
 
 func getDirGoFiles(dir string, args ...any) []string {
 	if dir == "./..." || dir == "./" || dir == "." || dir == "" {
@@ -57,12 +692,35 @@ func getDirGoFiles(dir string, args ...any) []string {
 			useTest = _arg
 		}
 	}
+	var outDir string
+	if *outDirFlag != "" {
+		outDir, _ = filepath.Abs(*outDirFlag)
+	}
 	var files []string
-	_ = filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
-		if err != nil ||
-			info.IsDir() ||
-			!strings.HasSuffix(path, ".go") ||
-			(!useTest && strings.Contains(path, "_test.go")) {
+	//WalkDir reads the entry types from the directories, only the matched files are made absolute
+	_ = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			//never sort the output of a previous -out-dir run
+			if outDir != "" {
+				if abs, _ := filepath.Abs(path); abs == outDir {
+					return filepath.SkipDir
+				}
+			}
+			if path != dir && (!conf.included(path, true) || isExcluded(path)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isExcluded(path) {
+			return nil
+		}
+		//with -between a file named explicitly is sorted whatever its extension
+		if (!strings.HasSuffix(path, ".go") && (path != dir || *betweenFlag == "")) ||
+			(!useTest && !*testsMatchSourceFlag && strings.Contains(path, "_test.go")) ||
+			!conf.included(path, false) {
 			return nil
 		}
 		path, e := filepath.Abs(path)
@@ -75,288 +733,913 @@ func getDirGoFiles(dir string, args ...any) []string {
 	return files
 }
 
-func getFuncReceiverTypeName(decl ast.Decl) string {
-	fnDecl, ok := decl.(*ast.FuncDecl)
-	if !ok {
+// getModulePath returns the module path of the nearest go.mod above the file, an empty string if there is none,
+// the module paths are cached by directory as the files of a directory share their go.mod
+func getModulePath(filename string) string {
+	dir, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
 		return ""
 	}
-	if fnDecl.Recv == nil {
-		return ""
+	if modulePath, ok := modulePaths.Load(dir); ok {
+		return modulePath.(string)
 	}
-	_type := fnDecl.Recv.List[0].Type
-	var _typeName string
-	switch __t := _type.(type) {
-	case *ast.StarExpr:
-		switch _type1 := __t.X.(type) {
-		case *ast.Ident:
-			_typeName = _type1.Name
-		case *ast.IndexExpr:
-			//Generics type
-			_typeName = _type1.X.(*ast.Ident).Name
-		default:
-			fmt.Printf("unknown type: %T, %#+v\n", _type1, __t.X)
+	var modulePath string
+	content, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err == nil {
+		for _, line := range strings.Split(string(content), "\n") {
+			if after, ok := strings.CutPrefix(strings.TrimSpace(line), "module"); ok && after != "" && (after[0] == ' ' || after[0] == '\t') {
+				after, _, _ = strings.Cut(after, "//")
+				modulePath = strings.Trim(strings.TrimSpace(after), `"`)
+				break
+			}
 		}
-	case *ast.Ident:
-		_typeName = __t.Name
+	} else if parent := filepath.Dir(dir); parent != dir {
+		modulePath = getModulePath(filepath.Join(parent, "go.mod"))
 	}
-	return _typeName
+	modulePaths.Store(dir, modulePath)
+	return modulePath
 }
 
-func getTypeFromFile(f *ast.File, name string) ast.Decl {
-	for _, decl := range f.Decls {
-		_decl, ok := decl.(*ast.GenDecl)
-		if !ok {
-			continue
-		}
-		if _decl.Tok != token.TYPE {
-			continue
+// getOutDirPath returns the path of file mirrored into -out-dir, relative to the sorted root
+func getOutDirPath(root, file string) (string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	if info, e := os.Stat(root); e == nil && !info.IsDir() {
+		root = filepath.Dir(root)
+	}
+	rel, err := filepath.Rel(root, file)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(*outDirFlag, rel), nil
+}
+
+// getTargetFiles returns the go files of all paths, a file reached through several paths is sorted once
+func getTargetFiles(paths []string) []targetFile {
+	var targets []targetFile
+	var seen = make(map[string]bool)
+	for _, path := range paths {
+		if path == "-" {
+			log.Fatalln("the standard input can't be sorted along with files")
 		}
-		for _, spec := range _decl.Specs {
-			_type := spec.(*ast.TypeSpec)
-			if _type.Name.Name == name {
-				return _decl
+		//a file named explicitly is sorted even if it is a test file
+		info, e := os.Stat(path)
+		for _, file := range getDirGoFiles(path, e == nil && !info.IsDir()) {
+			if seen[file] {
+				continue
 			}
+			seen[file] = true
+			targets = append(targets, targetFile{Root: path, File: file})
 		}
 	}
-	return nil
+	return targets
 }
 
-func isBeforePackageComment(f *ast.File, commentGroup *ast.CommentGroup) bool {
-	return commentGroup.Pos() < f.Package
+// hunkRange formats the start and the length of a hunk side, an empty side starts at the line before it
+func hunkRange(line, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", line-1)
+	case 1:
+		return fmt.Sprint(line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
 }
 
-func isDeclComment(f *ast.File, commentGroup *ast.CommentGroup) bool {
-	for _, decl := range f.Decls {
-		if commentGroup.End()+1 == decl.Pos() {
-			return true
+// isDiffTarget reports whether a file of a diff would be found by a walk, it is in the included dirs of the config
+// and neither it nor a directory above it matches -exclude
+func isDiffTarget(file string) bool {
+	if !conf.included(file, false) {
+		return false
+	}
+	for path := file; path != "." && path != string(filepath.Separator); path = filepath.Dir(path) {
+		if isExcluded(path) {
+			return false
 		}
 	}
-	return false
+	return true
 }
 
-func isStatementComment(f *ast.File, commentGroup *ast.CommentGroup) bool {
-	for _, decl := range f.Decls {
-		if decl.Pos() < commentGroup.Pos() && commentGroup.End() < decl.End() {
+// isExcluded reports whether a -exclude pattern matches the path or its base name
+func isExcluded(path string) bool {
+	for _, pattern := range excludeFlag {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
 			return true
 		}
 	}
 	return false
 }
 
-func loadFile() string {
-	path := os.Args[len(os.Args)-1]
-	execPath, _ := os.Executable()
-	if strings.HasSuffix(execPath, path) {
-		path = "."
-	}
-	_, err := os.Stat(path)
-	if err != nil {
-		log.Fatalf("file/dir %s not found\n", path)
-	}
-	return path
+// isGenerated reports whether a go file has the standard code generated comment above its package clause,
+// the same comment further down doesn't make a file generated
+func isGenerated(filename string, content []byte) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), filename, content, parser.PackageClauseOnly|parser.ParseComments)
+	return err == nil && ast.IsGenerated(f)
 }
 
-func sortActionByFilename(filename string) (err error) {
-	fSet := token.NewFileSet()
-	f, err := parser.ParseFile(fSet, filename, nil, parser.ParseComments)
-	if err != nil {
-		return
+// isVendorPath reports whether the file, or the root it was found from, resolves inside a vendor directory,
+// any vendor element of the absolute path counts, symlinks are followed when they can be
+func isVendorPath(root, file string) bool {
+	for _, path := range []string{root, file} {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		if slices.Contains(strings.Split(filepath.ToSlash(filepath.Clean(path)), "/"), "vendor") {
+			return true
+		}
 	}
-	ast.SortImports(fSet, f)
+	return false
+}
+
+// loadConfig loads the json config file, a missing default config file is not an error
+func loadConfig(filename string) (err error) {
 	content, err := os.ReadFile(filename)
 	if err != nil {
-		return
+		if errors.Is(err, fs.ErrNotExist) && filename == defaultConfigFile {
+			return nil
+		}
+		return fmt.Errorf("load config %s error: %w", filename, err)
 	}
-	var buf = new(bytes.Buffer)
-	writePkg(buf, fSet, f, content)
-	if err = write2buf(buf, f, content); err != nil {
-		return
+	if err = json.Unmarshal(content, conf); err != nil {
+		return fmt.Errorf("parse config %s error: %w", filename, err)
 	}
-	if err = os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+	base, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
 		return
 	}
+	for i, dir := range conf.IncludeDirs {
+		if !filepath.IsAbs(dir) {
+			conf.IncludeDirs[i] = filepath.Join(base, dir)
+		}
+	}
 	return
 }
 
-func sortFile() (err error) {
-	for _, file := range getDirGoFiles(loadFile()) {
-		if err = sortActionByFilename(file); err != nil {
-			return fmt.Errorf("sort file %s error: %w", file, err)
+// loadFile returns the files and directories to sort, "-" for the standard input
+func loadFile() []string {
+	paths := flag.Args()
+	if *manifestFlag != "" {
+		files, err := loadManifest(*manifestFlag)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		paths = append(paths, files...)
+		if len(paths) == 0 {
+			log.Fatalf("manifest %s lists no files\n", *manifestFlag)
 		}
 	}
-	return
+	if len(paths) == 0 {
+		paths = []string{"."}
+		if *stdinFilenameFlag != "" {
+			paths = []string{"-"}
+		}
+	}
+	for i, path := range paths {
+		if path == "-" {
+			continue
+		}
+		//a go package pattern, e.g. ./..., walks its root, directories are always walked recursively
+		if path == "..." || strings.HasSuffix(path, "/...") {
+			path = strings.TrimSuffix(path, "...")
+			if len(path) > 1 {
+				path = strings.TrimSuffix(path, "/")
+			}
+			if path == "" {
+				path = "."
+			}
+			paths[i] = path
+		}
+		_, err := os.Stat(path)
+		if err != nil {
+			log.Fatalf("file/dir %s not found\n", path)
+		}
+	}
+	return paths
 }
 
-func write2buf(buf *bytes.Buffer, f *ast.File, content []byte) (err error) {
-	write2bufTop(buf, f, content)
-	write2bufTopComment(buf, f, content)
-	writeMain(buf, f, content)
-	write2bufGenDecl(buf, f, content, token.CONST, false)
-	buf.WriteString("\n")
-	write2bufGenDecl(buf, f, content, token.VAR, false)
-	buf.WriteString("\n")
-	write2bufGenDecl(buf, f, content, token.TYPE, true)
-	write2bufFunc(buf, f, content, true)
-	ret, err := format.Source(buf.Bytes())
+// loadManifest returns the files listed by a build manifest, relative paths are relative to the manifest.
+// The manifest is a json object {"files": ["a.go", "b/c.go"]} or a json array of file paths.
+func loadManifest(filename string) (files []string, err error) {
+	content, err := os.ReadFile(filename)
 	if err != nil {
-		return
+		return nil, fmt.Errorf("load manifest %s error: %w", filename, err)
 	}
-	buf.Reset()
-	buf.Write(ret)
-	return
-}
-
-func write2bufAsDecl(buf *bytes.Buffer, content []byte, decl ast.Decl, writeLine bool) {
-	_decl := decl.(*ast.GenDecl)
-	posStart := _decl.Pos() - 1
-	if _decl.Doc != nil {
-		posStart = _decl.Doc.Pos() - 1
+	var m manifest
+	if err = json.Unmarshal(content, &m); err != nil {
+		if err = json.Unmarshal(content, &m.Files); err != nil {
+			return nil, fmt.Errorf("parse manifest %s error: %w", filename, err)
+		}
 	}
-	buf.Write(content[posStart:_decl.End()])
-	if writeLine {
-		buf.WriteString("\n")
+	base := filepath.Dir(filename)
+	for _, file := range m.Files {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(base, file)
+		}
+		files = append(files, file)
 	}
+	return
 }
 
-func write2bufAsFunc(buf *bytes.Buffer, content []byte, decl ast.Decl, writeLine bool) {
-	_decl := decl.(*ast.FuncDecl)
-	posStart := _decl.Pos() - 1
-	if _decl.Doc != nil {
-		posStart = _decl.Doc.Pos() - 1
-	}
-	buf.Write(content[posStart:_decl.End()])
-	if writeLine {
-		buf.WriteString("\n")
+// newFileResult returns the json result of a sorted file
+func newFileResult(file string, res sortResult) fileResult {
+	if !res.changed() {
+		return fileResult{File: file, Status: "sorted"}
 	}
+	return fileResult{File: file, Status: "unsorted", Reason: res.String()}
 }
 
-func write2bufFunc(buf *bytes.Buffer, f *ast.File, content []byte, writeLine bool) {
-	var list = make(letterDeclList, 0)
-	for _, decl := range f.Decls {
-		_decl, ok := decl.(*ast.FuncDecl)
-		if !ok {
+// parseDiffLines returns the changed line ranges of the new files of a unified diff, by file,
+// a deletion marks the lines around it since it makes them neighbors
+func parseDiffLines(diff []byte) map[string][][2]int {
+	changes := make(map[string][][2]int)
+	var file string
+	for _, line := range strings.Split(string(diff), "\n") {
+		if name, ok := strings.CutPrefix(line, "+++ "); ok {
+			name, _, _ = strings.Cut(name, "\t")
+			file = strings.TrimPrefix(name, "b/")
+			if file == "/dev/null" {
+				file = ""
+			}
+			continue
+		}
+		if file == "" || !strings.HasPrefix(line, "@@ ") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
 			continue
 		}
-		//if main or init, skip
-		if _decl.Name.Name == "main" || _decl.Name.Name == "init" {
+		start, count := 0, 1
+		startText, countText, hasCount := strings.Cut(fields[2][1:], ",")
+		if _, e := fmt.Sscan(startText, &start); e != nil {
 			continue
 		}
-		//if is a receiver function, and the receiver type is in the same file, skip
-		if _decl.Recv != nil {
-			if getTypeFromFile(f, getFuncReceiverTypeName(_decl)) != nil {
+		if hasCount {
+			if _, e := fmt.Sscan(countText, &count); e != nil {
 				continue
 			}
 		}
-		list = append(list, letterDecl{Letter: _decl.Name.Name, Decl: _decl})
+		if count == 0 {
+			changes[file] = append(changes[file], [2]int{start, start + 1})
+			continue
+		}
+		changes[file] = append(changes[file], [2]int{start, start + count - 1})
+	}
+	return changes
+}
+
+// proposeSort returns the sorted content of a file and how it differs from the current one, without writing anything,
+// with -between only the go sources between the markers are sorted
+func proposeSort(sorter *gosort.Sorter, filename string, content []byte) (out []byte, res sortResult, err error) {
+	if *betweenFlag == "" {
+		return proposeSortSource(sorter, filename, content)
+	}
+	start, end, _ := strings.Cut(*betweenFlag, ",")
+	rest := content
+	for {
+		i := bytes.Index(rest, []byte(start))
+		if i < 0 {
+			break
+		}
+		i += len(start)
+		j := bytes.Index(rest[i:], []byte(end))
+		if j < 0 {
+			break
+		}
+		block := rest[i : i+j]
+		out = append(out, rest[:i]...)
+		rest = rest[i+j:]
+		body := bytes.TrimSpace(block)
+		if len(body) == 0 {
+			out = append(out, block...)
+			continue
+		}
+		//a gofmt-clean source ends with a newline, the body is clipped so the newline never lands in content
+		sorted, blockRes, e := proposeSortSource(sorter, filename, append(slices.Clip(body), '\n'))
+		if e != nil {
+			line := bytes.Count(content[:len(content)-len(rest)-len(block)], []byte("\n")) + 1
+			return nil, res, fmt.Errorf("go source at line %d: %w", line, e)
+		}
+		//the text around the source, the blank lines next to the markers included, stays as is
+		out = append(out, block[:bytes.Index(block, body)]...)
+		out = append(out, bytes.TrimSpace(sorted)...)
+		out = append(out, block[bytes.Index(block, body)+len(body):]...)
+		res.Reordered = res.Reordered || blockRes.Reordered
+		res.Reformatted = res.Reformatted || blockRes.Reformatted
+		res.Other = res.Other || blockRes.Other
+		res.Moves = append(res.Moves, blockRes.Moves...)
 	}
-	sort.Sort(list)
-	for _, node := range list {
-		write2bufAsFunc(buf, content, node.Decl, writeLine)
+	return append(out, rest...), res, nil
+}
+
+// proposeSortSource returns the sorted content of a go source and how it differs from the current one,
+// with -safe a sorted content that lost or duplicated a declaration is an error
+func proposeSortSource(sorter *gosort.Sorter, filename string, content []byte) (out []byte, res sortResult, err error) {
+	if out, err = sorter.SortSource(filename, content); err != nil {
+		return
 	}
+	if *safeFlag {
+		if err = gosort.VerifyDecls(filename, content, out); err != nil {
+			return
+		}
+	}
+	res, err = compareSource(filename, content, out)
+	return
 }
 
-func write2bufGenDecl(buf *bytes.Buffer, f *ast.File, content []byte, tk token.Token, writeLine bool) {
-	var list = make(letterDeclList, 0)
-	for _, decl := range f.Decls {
-		if _decl, ok := decl.(*ast.GenDecl); ok {
-			if _decl.Tok == tk && _decl.Tok != token.IMPORT && _decl.Tok != token.TYPE {
-				name := _decl.Specs[0].(*ast.ValueSpec).Names[0].Name
-				list = append(list, letterDecl{Letter: name, Decl: _decl})
+// requireDocs prints the exported declarations of the files that have no doc comment,
+// a spec of a parenthesized declaration is documented by its own doc or by the doc of the declaration
+func requireDocs(files []string) (failed bool, err error) {
+	var errs []error
+	//the files that failed are reported once the others are checked
+	defer func() { err = errors.Join(append(errs, err)...) }()
+	for _, file := range files {
+		fSet := token.NewFileSet()
+		f, e := parser.ParseFile(fSet, file, nil, parser.ParseComments)
+		if e != nil {
+			if *failFastFlag {
+				return failed, e
 			}
-			if _decl.Tok == tk && _decl.Tok == token.TYPE {
-				name := _decl.Specs[0].(*ast.TypeSpec).Name.Name
-				list = append(list, letterDecl{Letter: name, Decl: _decl})
+			errs = append(errs, e)
+			continue
+		}
+		report := func(pos token.Pos, kind, name string) {
+			failed = true
+			fmt.Printf("%s: exported %s %s has no doc comment\n", fSet.Position(pos), kind, name)
+		}
+		for _, decl := range f.Decls {
+			switch _decl := decl.(type) {
+			case *ast.FuncDecl:
+				if _decl.Doc == nil && ast.IsExported(_decl.Name.Name) {
+					kind, name := gosort.DeclKindName(_decl)
+					report(_decl.Pos(), kind, name)
+				}
+			case *ast.GenDecl:
+				if _decl.Doc != nil || _decl.Tok == token.IMPORT {
+					continue
+				}
+				for _, spec := range _decl.Specs {
+					switch _spec := spec.(type) {
+					case *ast.TypeSpec:
+						if _spec.Doc == nil && ast.IsExported(_spec.Name.Name) {
+							report(_spec.Pos(), _decl.Tok.String(), _spec.Name.Name)
+						}
+					case *ast.ValueSpec:
+						for _, name := range _spec.Names {
+							if _spec.Doc == nil && ast.IsExported(name.Name) {
+								report(name.Pos(), _decl.Tok.String(), name.Name)
+							}
+						}
+					}
+				}
 			}
 		}
 	}
-	sort.Sort(list)
-	for _, node := range list {
-		write2bufAsDecl(buf, content, node.Decl, writeLine)
-		_decl := node.Decl.(*ast.GenDecl)
-		if _decl.Tok == token.TYPE {
-			//get the group of types, and write receiver function
-			for _, spec := range _decl.Specs {
-				__name := spec.(*ast.TypeSpec).Name.Name
-				writeTypesReceiverFunc(f, __name, buf, content, writeLine)
+	return
+}
+
+// shouldFail reports whether go-sort exits 1 once the files needing a sort are found
+func shouldFail(needSort bool) bool {
+	return needSort && (*checkFlag || *diffExitCodeFlag || *listFlag || *verifyFlag || *requireDocFlag || *diffScopeFlag != "")
+}
+
+// sortActionByFilename sorts a file and writes the result to dest, which is the file itself unless -out-dir is set,
+// dest gets the permissions of the file, what is printed for the file goes to w
+func sortActionByFilename(sorter *gosort.Sorter, w io.Writer, filename, dest string) (res sortResult, err error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	if !*includeGeneratedFlag && isGenerated(filename, content) {
+		res.Generated = true
+		//-stdout still prints the file, as it is
+		if *stdoutFlag {
+			_, err = w.Write(content)
+		}
+		return
+	}
+	if *groupImportsFlag && *localFlag == "" {
+		sorter = sorter.ForModule(getModulePath(filename))
+	}
+	if *sortStructFieldsFlag {
+		if sorter, err = forPackage(sorter, filename); err != nil {
+			return
+		}
+	}
+	if *testsMatchSourceFlag && strings.HasSuffix(filename, "_test.go") {
+		if tested, e := os.ReadFile(strings.TrimSuffix(filename, "_test.go") + ".go"); e == nil {
+			if sorter, err = sorter.ForTest(tested); err != nil {
+				return
 			}
 		}
 	}
+	out, res, err := proposeSort(sorter, filename, content)
+	if err != nil {
+		return
+	}
+	if *stdoutFlag {
+		_, err = w.Write(withTrailingNewline(out))
+		return
+	}
+	if *diffFlag || *diffExitCodeFlag {
+		_, err = w.Write(unifiedDiff(filename, content, out, *diffContextFlag))
+		return
+	}
+	if *reportCommentsFlag {
+		moves, e := commentMoves(filename, content, out)
+		if e != nil {
+			return res, e
+		}
+		for _, move := range moves {
+			fmt.Fprintf(w, "%s:%d: comment %q moves to line %d\n", filename, move.FromLine, move.Text, move.ToLine)
+		}
+		return
+	}
+	if *checkFlag || *listFlag || *noopFlag || *diffFormatFlag != "" || *impactFlag {
+		return
+	}
+	//an unchanged file is never rewritten, so its modification time only moves when its content does
+	if dest == filename && bytes.Equal(content, out) {
+		return
+	}
+	if existing, e := os.ReadFile(dest); dest != filename && e == nil && bytes.Equal(existing, out) {
+		return
+	}
+	if *dryRunFlag {
+		fmt.Fprintf(w, "would write %s\n", dest)
+		return
+	}
+	perm := info.Mode().Perm()
+	if dest == filename {
+		err = writeFile(dest, out, perm)
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return
+	}
+	if *outModeFlag != "" {
+		//validated by sortFile
+		mode, _ := strconv.ParseUint(*outModeFlag, 8, 32)
+		perm = os.FileMode(mode).Perm()
+	}
+	if err = writeFile(dest, out, perm); err != nil {
+		return
+	}
+	//the umask applies to created files and an existing file keeps its mode, the mirrored mode must be exact
+	return res, os.Chmod(dest, perm)
 }
 
-func write2bufTop(buf *bytes.Buffer, f *ast.File, content []byte) {
-	list := make(letterDeclList, 0)
-	for _, decl := range f.Decls {
-		if _decl, ok := decl.(*ast.GenDecl); ok {
-			if _decl.Tok == token.IMPORT {
-				list = append(list, letterDecl{Letter: "import", Decl: _decl})
+func sortFile(sorter *gosort.Sorter) (needSort bool, err error) {
+	if *diffFormatFlag != "" && *diffFormatFlag != "json" {
+		return false, fmt.Errorf("unknown diff format: %s", *diffFormatFlag)
+	}
+	if mode, e := strconv.ParseUint(*outModeFlag, 8, 32); *outModeFlag != "" && (e != nil || mode > 0777) {
+		return false, fmt.Errorf("invalid -out-mode: %s", *outModeFlag)
+	}
+	if *jobsFlag < 1 {
+		return false, fmt.Errorf("-j must be at least 1: %d", *jobsFlag)
+	}
+	if *diffContextFlag < 0 {
+		return false, fmt.Errorf("negative diff context: %d", *diffContextFlag)
+	}
+	if start, end, ok := strings.Cut(*betweenFlag, ","); *betweenFlag != "" && (!ok || start == "" || end == "") {
+		return false, fmt.Errorf("-between needs a START,END pair of markers: %s", *betweenFlag)
+	}
+	if *diffScopeFlag != "" {
+		return checkDiffScope(sorter, *diffScopeFlag)
+	}
+	paths := loadFile()
+	if len(paths) == 1 && paths[0] == "-" {
+		return sortStdin(sorter)
+	}
+	targets := getTargetFiles(paths)
+	if *protectVendorFlag {
+		for _, target := range targets {
+			if isVendorPath(target.Root, target.File) {
+				return false, fmt.Errorf("%s is vendored, refusing to sort it with -protect-vendor", target.File)
+			}
+		}
+	}
+	if *verifyFlag {
+		files := make([]string, 0, len(targets))
+		for _, target := range targets {
+			files = append(files, target.File)
+		}
+		return verifyFiles(sorter, files)
+	}
+	if *requireDocFlag {
+		files := make([]string, 0, len(targets))
+		for _, target := range targets {
+			files = append(files, target.File)
+		}
+		return requireDocs(files)
+	}
+	var report = make([]fileMoves, 0)
+	var results = make([]fileResult, 0)
+	var impact repoImpact
+	var errs []error
+	for i, job := range sortTargets(sorter, targets) {
+		file, res, e := targets[i].File, job.res, job.err
+		if !job.done {
+			//cancelled by -fail-fast, an earlier file failed
+			break
+		}
+		if _, e := os.Stdout.Write(job.output.Bytes()); e != nil {
+			return needSort, e
+		}
+		if e != nil {
+			results = append(results, fileResult{File: file, Status: "error", Reason: e.Error()})
+			errs = append(errs, fmt.Errorf("sort file %s error: %w", file, e))
+			if *failFastFlag {
+				break
+			}
+			continue
+		}
+		if res.Generated {
+			results = append(results, fileResult{File: file, Status: "skipped", Reason: "generated"})
+			if *noopFlag {
+				fmt.Printf("skipping generated %s\n", file)
+			}
+			continue
+		}
+		if len(res.Moves) > 0 {
+			report = append(report, fileMoves{File: file, Moves: res.Moves})
+		}
+		impact.add(file, res)
+		results = append(results, newFileResult(file, res))
+		if *noopFlag {
+			if res.changed() {
+				fmt.Printf("would sort %s: %s\n", file, res)
+			} else {
+				fmt.Printf("%s already sorted\n", file)
+			}
+		}
+		if !res.changed() {
+			continue
+		}
+		needSort = true
+		if *checkFlag {
+			fmt.Printf("%s: %s\n", file, res)
+		}
+		if *listFlag {
+			delim := "\n"
+			if *nulFlag {
+				delim = "\x00"
 			}
+			fmt.Print(file + delim)
 		}
 	}
-	for _, decl := range list {
-		write2bufAsDecl(buf, content, decl.Decl, true)
+	//the files that failed are reported once the others are done
+	defer func() { err = errors.Join(append(errs, err)...) }()
+	if *resultsFlag != "" {
+		if err = writeResults(*resultsFlag, results); err != nil {
+			return
+		}
+	}
+	if *failFastFlag && len(errs) > 0 {
+		return
+	}
+	if *diffFormatFlag == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return needSort, enc.Encode(report)
 	}
+	if *impactFlag {
+		fmt.Print(&impact)
+	}
+	return
 }
 
-func write2bufTopComment(buf *bytes.Buffer, f *ast.File, content []byte) {
-	for _, commentGroup := range f.Comments {
-		if !isDeclComment(f, commentGroup) &&
-			!isStatementComment(f, commentGroup) &&
-			!isBeforePackageComment(f, commentGroup) {
-			buf.Write(content[commentGroup.Pos()-1 : commentGroup.End()])
-			buf.WriteString("\n")
+// sortStdin sorts the standard input to the standard output,
+// -stdin-filename is used as the file name in errors and reports
+func sortStdin(sorter *gosort.Sorter) (needSort bool, err error) {
+	filename := *stdinFilenameFlag
+	if filename == "" {
+		filename = "<standard input>"
+	}
+	content, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return
+	}
+	if *groupImportsFlag && *localFlag == "" && *stdinFilenameFlag != "" {
+		sorter = sorter.ForModule(getModulePath(*stdinFilenameFlag))
+	}
+	out, res, err := proposeSort(sorter, filename, content)
+	if err != nil {
+		return
+	}
+	needSort = res.changed()
+	switch {
+	case *diffFlag || *diffExitCodeFlag:
+		_, err = os.Stdout.Write(unifiedDiff(filename, content, out, *diffContextFlag))
+	case *checkFlag:
+		if needSort {
+			fmt.Printf("%s: %s\n", filename, res)
 		}
+	case *diffFormatFlag == "json":
+		var report = make([]fileMoves, 0)
+		if len(res.Moves) > 0 {
+			report = append(report, fileMoves{File: filename, Moves: res.Moves})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	default:
+		_, err = os.Stdout.Write(withTrailingNewline(out))
 	}
+	return
 }
 
-func writeMain(buf *bytes.Buffer, f *ast.File, content []byte) {
-	for _, decl := range f.Decls {
-		_decl, ok := decl.(*ast.FuncDecl)
-		if !ok {
-			continue
-		}
-		// if has receiver, skip
-		if _decl.Recv != nil {
-			continue
+// sortTargets sorts the targets with a pool of -j workers, the jobs are returned in the order of the targets,
+// the output of every file is buffered so it is printed in that order too,
+// with -fail-fast the first failure cancels the targets not started yet
+func sortTargets(sorter *gosort.Sorter, targets []targetFile) []sortJob {
+	jobs := make([]sortJob, len(targets))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queue := make(chan int)
+	//failed is the index of the first target that failed with -fail-fast, the targets after it are skipped
+	var mu sync.Mutex
+	failed := len(targets)
+	isAfterFailure := func(i int) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return i > failed
+	}
+	var wg sync.WaitGroup
+	for n := 0; n < *jobsFlag; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if isAfterFailure(i) {
+					//dispatched as the cancel of -fail-fast raced with the send
+					continue
+				}
+				job := &jobs[i]
+				dest := targets[i].File
+				if *outDirFlag != "" {
+					dest, job.err = getOutDirPath(targets[i].Root, targets[i].File)
+				}
+				if job.err == nil {
+					job.res, job.err = sortActionByFilename(sorter, &job.output, targets[i].File, dest)
+				}
+				job.done = true
+				if job.err != nil && *failFastFlag {
+					mu.Lock()
+					failed = min(failed, i)
+					mu.Unlock()
+					cancel()
+				}
+			}
+		}()
+	}
+dispatch:
+	for i := range targets {
+		select {
+		case queue <- i:
+		case <-ctx.Done():
+			break dispatch
 		}
-		if _decl.Name.Name == "main" || _decl.Name.Name == "init" {
-			write2bufAsFunc(buf, content, _decl, true)
+	}
+	close(queue)
+	wg.Wait()
+	return jobs
+}
+
+// splitLines splits content after every newline, the last line has no newline if content does not end with one
+func splitLines(content []byte) []string {
+	var lines []string
+	for len(content) > 0 {
+		i := bytes.IndexByte(content, '\n') + 1
+		if i == 0 {
+			i = len(content)
 		}
+		lines = append(lines, string(content[:i]))
+		content = content[i:]
 	}
+	return lines
 }
 
-func writePkg(buf *bytes.Buffer, fSet *token.FileSet, f *ast.File, content []byte) {
-	line := fSet.Position(f.Package).Line
-	var bufTop = make([]byte, 0)
-	var idx = 0
-	for i := 0; i < line; i++ {
-		c := bytes.IndexByte(content[idx:], '\n')
-		if c == -1 {
+// splitList splits a comma separated flag value, an empty value is an empty list
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// unifiedDiff returns the unified diff of the lines of a and b with context lines around every change,
+// the edit script is the shortest one found by the Myers algorithm
+func unifiedDiff(filename string, a, b []byte, context int) []byte {
+	x, y := splitLines(a), splitLines(b)
+	n, m := len(x), len(y)
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	// trace[d] holds the furthest reaching paths of the diagonals -d to d before the step d, the only ones backtracking reads
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, slices.Clone(v[offset-d:offset+d+1]))
+		done := false
+		for k := -d; k <= d && !done; k += 2 {
+			var i int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				i = v[offset+k+1]
+			} else {
+				i = v[offset+k-1] + 1
+			}
+			j := i - k
+			for i < n && j < m && x[i] == y[j] {
+				i, j = i+1, j+1
+			}
+			v[offset+k] = i
+			done = i >= n && j >= m
+		}
+		if done {
 			break
 		}
-		idx += c + 1
 	}
-	bufTop = append(bufTop, content[:idx]...)
-	buf.Write(bufTop)
+	// ops holds ' ', '-' or '+' for every line of the edit script, in reverse order while backtracking
+	var ops []byte
+	var lines []string
+	i, j := n, m
+	for d := len(trace) - 1; d >= 0 && (i > 0 || j > 0); d-- {
+		v := trace[d]
+		k := i - j
+		var prevK, prevI int
+		switch {
+		case d == 0:
+		case k == -d || (k != d && v[d+k-1] < v[d+k+1]):
+			prevK = k + 1
+			prevI = v[d+prevK]
+		default:
+			prevK = k - 1
+			prevI = v[d+prevK]
+		}
+		prevJ := prevI - prevK
+		for i > prevI && j > prevJ {
+			i, j = i-1, j-1
+			ops, lines = append(ops, ' '), append(lines, x[i])
+		}
+		if d == 0 {
+			break
+		}
+		if i == prevI {
+			j--
+			ops, lines = append(ops, '+'), append(lines, y[j])
+		} else {
+			i--
+			ops, lines = append(ops, '-'), append(lines, x[i])
+		}
+	}
+	slices.Reverse(ops)
+	slices.Reverse(lines)
+	var buf bytes.Buffer
+	for start := 0; start < len(ops); {
+		for start < len(ops) && ops[start] == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		// a hunk ends once more than 2*context unchanged lines follow its last change
+		end := start
+		for k := start; k < len(ops); k++ {
+			if ops[k] != ' ' {
+				end = k + 1
+			} else if k-end >= 2*context {
+				break
+			}
+		}
+		from, to := max(start-context, 0), min(end+context, len(ops))
+		aLine, bLine := 1, 1
+		for _, op := range ops[:from] {
+			if op != '+' {
+				aLine++
+			}
+			if op != '-' {
+				bLine++
+			}
+		}
+		var aCount, bCount int
+		for _, op := range ops[from:to] {
+			if op != '+' {
+				aCount++
+			}
+			if op != '-' {
+				bCount++
+			}
+		}
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "--- %s\n+++ %s\n", filename, filename)
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(aLine, aCount), hunkRange(bLine, bCount))
+		for k := from; k < to; k++ {
+			buf.WriteByte(ops[k])
+			buf.WriteString(lines[k])
+			if !strings.HasSuffix(lines[k], "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = to
+	}
+	return buf.Bytes()
 }
 
-// writeTypesReceiverFunc write receiver function of type
-func writeTypesReceiverFunc(f *ast.File, name string, buf *bytes.Buffer, content []byte, writeLine bool) {
-	var list = make(letterDeclList, 0)
-	for _, decl := range f.Decls {
-		_decl, ok := decl.(*ast.FuncDecl)
-		if !ok {
-			continue
+// verifyFiles sorts every file twice in memory and reports the files whose second sort differs from the first
+func verifyFiles(sorter *gosort.Sorter, files []string) (failed bool, err error) {
+	var errs []error
+	//the files that failed are reported once the others are verified
+	defer func() { err = errors.Join(append(errs, err)...) }()
+	for _, file := range files {
+		var once, twice []byte
+		content, e := os.ReadFile(file)
+		if e == nil {
+			if once, e = sorter.SortSource(file, content); e != nil {
+				e = fmt.Errorf("sort file %s error: %w", file, e)
+			} else if twice, e = sorter.SortSource(file, once); e != nil {
+				e = fmt.Errorf("sort file %s again error: %w", file, e)
+			}
 		}
-		if _decl.Recv == nil {
+		if e != nil {
+			if *failFastFlag {
+				return failed, e
+			}
+			errs = append(errs, e)
 			continue
 		}
-		if getFuncReceiverTypeName(_decl) != name {
+		if bytes.Equal(once, twice) {
 			continue
 		}
-		list = append(list, letterDecl{Letter: _decl.Name.Name, Decl: _decl})
+		failed = true
+		line := 1
+		for i := 0; i < len(once) && i < len(twice) && once[i] == twice[i]; i++ {
+			if once[i] == '\n' {
+				line++
+			}
+		}
+		fmt.Printf("%s: not idempotent, second sort differs at line %d\n", file, line)
 	}
-	sort.Sort(list)
-	for _, node := range list {
-		write2bufAsFunc(buf, content, node.Decl, writeLine)
+	return
+}
+
+// versionInfo returns the version and build info of the binary, one "key value" line each,
+// version, go, then the vcs settings recorded by the go command, e.g. vcs.revision and vcs.modified
+func versionInfo() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "version unknown\n"
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "version %s\ngo %s\n", info.Main.Version, info.GoVersion)
+	for _, setting := range info.Settings {
+		if strings.HasPrefix(setting.Key, "vcs") {
+			fmt.Fprintf(&buf, "%s %s\n", setting.Key, setting.Value)
+		}
+	}
+	return buf.String()
+}
+
+// withTrailingNewline returns the content ending with exactly one newline, as gofmt writes it
+func withTrailingNewline(content []byte) []byte {
+	return append(bytes.TrimRight(content, "\n"), '\n')
+}
+
+// writeFile writes a sorted file, with -serialize-writes all writes go through a single goroutine
+func writeFile(filename string, data []byte, perm os.FileMode) error {
+	if !*serializeWritesFlag {
+		return os.WriteFile(filename, data, perm)
+	}
+	writeQueueOnce.Do(func() {
+		writeQueue = make(chan writeRequest)
+		go func() {
+			for req := range writeQueue {
+				req.done <- os.WriteFile(req.filename, req.data, req.perm)
+			}
+		}()
+	})
+	done := make(chan error, 1)
+	writeQueue <- writeRequest{filename: filename, data: data, perm: perm, done: done}
+	return <-done
+}
+
+// writeResults writes the json results of the sorted files to a file, whatever is printed to the standard output
+func writeResults(filename string, results []fileResult) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
 	}
+	return os.WriteFile(filename, append(data, '\n'), 0644)
 }
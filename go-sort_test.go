@@ -0,0 +1,2178 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"go-sort/gosort"
+)
+
+// flagCases are the runs of go-sort in a directory holding files, $DIR stands for that directory
+var flagCases = []struct {
+	name  string
+	files map[string]string
+	args  []string
+	stdin string
+	want  string            //the standard output
+	after map[string]string //the files after the run, nil when missing
+	err   string
+	fail  bool //go-sort exits 1
+}{
+	{
+		name: "anchor",
+		files: map[string]string{"a.go": `package a
+
+func d() {}
+
+func c() {}
+
+// ---
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-stdout", "-anchor", "---", "a.go"},
+		want: `package a
+
+func c() {}
+
+func d() {}
+
+// ---
+
+func a() {}
+
+func b() {}
+`,
+	},
+	{
+		name: "associate-funcs",
+		files: map[string]string{"a.go": `package a
+
+func NewServer() *Server { return nil }
+
+func Other() {}
+
+type Server struct{}
+
+func (s *Server) Run() {}
+`},
+		args: []string{"-stdout", "-associate-funcs", "New{type}", "a.go"},
+		want: `package a
+
+type Server struct{}
+
+func (s *Server) Run() {}
+
+func NewServer() *Server { return nil }
+
+func Other() {}
+`,
+	},
+	{
+		name: "blank-decls",
+		files: map[string]string{"a.go": `package a
+
+var _ I = (*T)(nil)
+
+var b = 1
+
+var a = 2
+
+type I interface{}
+
+type T struct{}
+`},
+		args: []string{"-stdout", "-blank-decls", "bottom", "a.go"},
+		want: `package a
+
+var a = 2
+var b = 1
+var _ I = (*T)(nil)
+
+type I interface{}
+
+type T struct{}
+`,
+	},
+	{
+		name: "ci",
+		files: map[string]string{"a.go": `package a
+
+func banana() {}
+
+func Apple() {}
+
+func apple() {}
+
+func Cherry() {}
+`},
+		args: []string{"-stdout", "-ci", "a.go"},
+		want: `package a
+
+func Apple() {}
+
+func Cherry() {}
+
+func apple() {}
+
+func banana() {}
+`,
+	},
+	{
+		name: "collate",
+		files: map[string]string{"a.go": `package a
+
+func zèbre() {}
+
+func éclair() {}
+
+func eau() {}
+`},
+		args: []string{"-stdout", "-collate", "fr", "a.go"},
+		want: `package a
+
+func eau() {}
+
+func éclair() {}
+
+func zèbre() {}
+`,
+	},
+	{
+		name: "enforce",
+		files: map[string]string{"a.go": `package a
+
+type B struct{}
+
+func (B) d() {}
+
+func (B) c() {}
+
+type A struct{}
+
+func z() {}
+
+func y() {}
+`},
+		args: []string{"-stdout", "-enforce", "func", "a.go"},
+		want: `package a
+
+type B struct{}
+
+func (B) d() {}
+
+func (B) c() {}
+
+type A struct{}
+
+func y() {}
+
+func z() {}
+`,
+	},
+	{
+		name: "enum-cluster",
+		files: map[string]string{"a.go": `package a
+
+func (c Color) String() string { return colorNames[c] }
+
+var colorNames = map[Color]string{Red: "red", Blue: "blue"}
+
+type Color int
+
+const (
+	Red Color = iota
+	Blue
+)
+
+var a = 1
+`},
+		args: []string{"-stdout", "-enum-cluster", "a.go"},
+		want: `package a
+
+const (
+	Red Color = iota
+	Blue
+)
+
+func (c Color) String() string { return colorNames[c] }
+
+var colorNames = map[Color]string{Red: "red", Blue: "blue"}
+
+var a = 1
+
+type Color int
+`,
+	},
+	{
+		name: "errors-with-type",
+		files: map[string]string{"a.go": `package a
+
+import "errors"
+
+var ErrServerDown = errors.New("down")
+
+var a = 1
+
+type Server struct{}
+`},
+		args: []string{"-stdout", "-errors-with-type", "a.go"},
+		want: `package a
+
+import "errors"
+
+var a = 1
+
+type Server struct{}
+
+var ErrServerDown = errors.New("down")
+`,
+	},
+	{
+		name: "export-first",
+		files: map[string]string{"a.go": `package a
+
+func b() {}
+
+func B() {}
+
+func a() {}
+
+type b2 struct{}
+
+type A2 struct{}
+`},
+		args: []string{"-stdout", "-export-first", "type", "a.go"},
+		want: `package a
+
+type A2 struct{}
+
+type b2 struct{}
+
+func a() {}
+
+func B() {}
+
+func b() {}
+`,
+	},
+	{
+		name: "first",
+		files: map[string]string{"a.go": `package a
+
+var b = 1
+
+var registry = map[string]int{}
+
+var a = 2
+`},
+		args: []string{"-stdout", "-first", "registry", "a.go"},
+		want: `package a
+
+var registry = map[string]int{}
+var a = 2
+var b = 1
+`,
+	},
+	{
+		name: "group-func-vars",
+		files: map[string]string{"a.go": `package a
+
+var b = func() {}
+
+var z = 1
+
+var a = func() {}
+`},
+		args: []string{"-stdout", "-group-func-vars", "a.go"},
+		want: `package a
+
+var z = 1
+
+var a = func() {}
+var b = func() {}
+`,
+	},
+	{
+		name: "group-imports",
+		files: map[string]string{
+			"a.go": `package a
+
+import (
+	"example.com/m/x"
+	"github.com/a/b"
+	"fmt"
+)
+
+var _ = fmt.Sprint(x.A, b.B)
+`,
+			"go.mod": `module example.com/m
+
+go 1.21
+`,
+		},
+		args: []string{"-stdout", "-group-imports", "a.go"},
+		want: `package a
+
+import (
+	"fmt"
+
+	"github.com/a/b"
+
+	"example.com/m/x"
+)
+
+var _ = fmt.Sprint(x.A, b.B)
+`,
+	},
+	{
+		name: "local",
+		files: map[string]string{"a.go": `package a
+
+import (
+	"example.com/m/x"
+	"github.com/a/b"
+	"fmt"
+)
+
+var _ = fmt.Sprint(x.A, b.B)
+`},
+		args: []string{"-stdout", "-local", "github.com/a", "a.go"},
+		want: `package a
+
+import (
+	"fmt"
+
+	"example.com/m/x"
+
+	"github.com/a/b"
+)
+
+var _ = fmt.Sprint(x.A, b.B)
+`,
+	},
+	{
+		name: "group-orphan-methods",
+		files: map[string]string{"a.go": `package a
+
+func (o *Other) b() {}
+
+func z() {}
+
+func (o *Other) a() {}
+
+func y() {}
+`},
+		args: []string{"-stdout", "-group-orphan-methods", "a.go"},
+		want: `package a
+
+func y() {}
+
+func z() {}
+
+func (o *Other) a() {}
+
+func (o *Other) b() {}
+`,
+	},
+	{
+		name: "helpers-after-callers",
+		files: map[string]string{"a.go": `package a
+
+func helper() {}
+
+func Zed() { helper() }
+
+func Alpha() {}
+`},
+		args: []string{"-stdout", "-helpers-after-callers", "a.go"},
+		want: `package a
+
+func Alpha() {}
+
+func Zed() { helper() }
+
+func helper() {}
+`,
+	},
+	{
+		name: "impl-methods-first",
+		files: map[string]string{"a.go": `package a
+
+type Runner interface {
+	Stop()
+	Start()
+}
+
+type T struct{}
+
+func (T) a() {}
+
+func (T) Start() {}
+
+func (T) Stop() {}
+`},
+		args: []string{"-stdout", "-impl-methods-first", "Runner", "a.go"},
+		want: `package a
+
+type Runner interface {
+	Stop()
+	Start()
+}
+
+type T struct{}
+
+func (T) Stop() {}
+
+func (T) Start() {}
+
+func (T) a() {}
+`,
+	},
+	{
+		name: "include-generated",
+		files: map[string]string{"a.go": `// Code generated by x. DO NOT EDIT.
+
+package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-stdout", "-include-generated", "a.go"},
+		want: `// Code generated by x. DO NOT EDIT.
+
+package a
+
+func a() {}
+
+func b() {}
+`,
+	},
+	{
+		name: "generated",
+		files: map[string]string{"a.go": `// Code generated by x. DO NOT EDIT.
+
+package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-stdout", "a.go"},
+		want: `// Code generated by x. DO NOT EDIT.
+
+package a
+
+func b() {}
+
+func a() {}
+`,
+	},
+	{
+		name: "keep-blank-lines",
+		files: map[string]string{"a.go": `package a
+
+const b = 1
+
+const a = 2
+const c = 3
+`},
+		args: []string{"-stdout", "-keep-blank-lines", "a.go"},
+		want: `package a
+
+const a = 2
+
+const b = 1
+const c = 3
+`,
+	},
+	{
+		name: "keep-value-runs",
+		files: map[string]string{"a.go": `package a
+
+var z = 1
+
+// run
+const y = 1
+var x = 2
+
+const a = 3
+`},
+		args: []string{"-stdout", "-keep-value-runs", "a.go"},
+		want: `package a
+
+const a = 3
+
+// run
+const y = 1
+
+var x = 2
+
+var z = 1
+`,
+	},
+	{
+		name: "main-first",
+		files: map[string]string{"a.go": `package main
+
+func init() {}
+
+func b() {}
+
+func main() {}
+`},
+		args: []string{"-stdout", "-main-first", "a.go"},
+		want: `package main
+
+func main() {}
+
+func init() {}
+
+func b() {}
+`,
+	},
+	{
+		name: "marker",
+		files: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-stdout", "-marker", "top", "a.go"},
+		want: `package a
+
+// sorted by go-sort
+
+func a() {}
+
+func b() {}
+`,
+	},
+	{
+		name: "marker-build-constraints",
+		files: map[string]string{"a.go": `//go:build linux
+// +build linux
+
+package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-marker", "top", "a.go"},
+		after: map[string]string{"a.go": `//go:build linux
+// +build linux
+
+package a
+
+// sorted by go-sort
+
+func a() {}
+
+func b() {}
+`},
+	},
+	{
+		name: "method-sort",
+		files: map[string]string{"a.go": `package a
+
+type T struct{}
+
+func (T) a(x, y int) {}
+
+func (T) c() {}
+
+func (T) b(x int) {}
+`},
+		args: []string{"-stdout", "-method-sort", "arity", "a.go"},
+		want: `package a
+
+type T struct{}
+
+func (T) c() {}
+
+func (T) b(x int) {}
+
+func (T) a(x, y int) {}
+`,
+	},
+	{
+		name: "only-methods-of",
+		files: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+
+type T struct{}
+
+func (T) d() {}
+
+func (T) c() {}
+`},
+		args: []string{"-stdout", "-only-methods-of", "T", "a.go"},
+		want: `package a
+
+func b() {}
+
+func a() {}
+
+type T struct{}
+
+func (T) c() {}
+
+func (T) d() {}
+`,
+	},
+	{
+		name: "preserve-order-for",
+		files: map[string]string{"a.go": `package a
+
+func zb() {}
+
+func a() {}
+
+func za() {}
+`},
+		args: []string{"-stdout", "-preserve-order-for", "z*", "a.go"},
+		want: `package a
+
+func a() {}
+
+func zb() {}
+
+func za() {}
+`,
+	},
+	{
+		name: "separate-methods",
+		files: map[string]string{"a.go": `package a
+
+type T struct{}
+
+func (T) b() {}
+
+func a() {}
+
+func c() {}
+`},
+		args: []string{"-stdout", "-separate-methods", "a.go"},
+		want: `package a
+
+type T struct{}
+
+func a() {}
+
+func (T) b() {}
+
+func c() {}
+`,
+	},
+	{
+		name: "sort-interfaces",
+		files: map[string]string{"a.go": `package a
+
+type I interface {
+	Stop()
+	Start()
+}
+`},
+		args: []string{"-stdout", "-sort-interfaces", "a.go"},
+		want: `package a
+
+type I interface {
+	Start()
+	Stop()
+}
+`,
+	},
+	{
+		name: "sort-struct-fields",
+		files: map[string]string{
+			"a.go": `package a
+
+type P struct {
+	y int
+	x int
+}
+
+type Q struct {
+	b int
+	a int
+}
+`,
+			"b.go": `package a
+
+var p = P{1, 2}
+`,
+		},
+		args: []string{"-stdout", "-sort-struct-fields", "a.go"},
+		want: `package a
+
+type P struct {
+	y int
+	x int
+}
+
+type Q struct {
+	a int
+	b int
+}
+`,
+	},
+	{
+		name: "sort-within-blocks",
+		files: map[string]string{"a.go": `package a
+
+var (
+	b = 1
+	a = 2
+)
+`},
+		args: []string{"-stdout", "-sort-within-blocks", "a.go"},
+		want: `package a
+
+var (
+	a = 2
+	b = 1
+)
+`,
+	},
+	{
+		name: "strip-prefix",
+		files: map[string]string{"a.go": `package a
+
+func MustC() {}
+
+func B() {}
+
+func A() {}
+`},
+		args: []string{"-stdout", "-strip-prefix", "Must", "a.go"},
+		want: `package a
+
+func A() {}
+
+func B() {}
+
+func MustC() {}
+`,
+	},
+	{
+		name: "strip-suffix",
+		files: map[string]string{"a.go": `package a
+
+func BHandler() {}
+
+func C() {}
+
+func A() {}
+`},
+		args: []string{"-stdout", "-strip-suffix", "Handler", "a.go"},
+		want: `package a
+
+func A() {}
+
+func BHandler() {}
+
+func C() {}
+`,
+	},
+	{
+		name:  "strip-ws",
+		files: map[string]string{"a.go": "package a\n\nvar b = `x   \ny`\n\nvar a = 1\n"},
+		args:  []string{"-stdout", "-strip-ws", "a.go"},
+		want:  "package a\n\nvar a = 1\nvar b = `x   \ny`\n",
+	},
+	{
+		name: "tests-match-source",
+		files: map[string]string{
+			"a.go": `package a
+
+func Alpha() {}
+
+type T struct{}
+`,
+			"a_test.go": `package a
+
+import "testing"
+
+func TestAlpha(t *testing.T) {}
+
+func TestT(t *testing.T) {}
+`,
+		},
+		args: []string{"-stdout", "-tests-match-source", "a_test.go"},
+		want: `package a
+
+import "testing"
+
+func TestT(t *testing.T) {}
+
+func TestAlpha(t *testing.T) {}
+`,
+	},
+	{
+		name: "config",
+		files: map[string]string{
+			".go-sort.json": "{\"priority\": [\"registry\"]}",
+			"a.go": `package a
+
+var b = 1
+
+var registry = map[string]int{}
+
+var a = 2
+`,
+		},
+		args: []string{"-stdout", "a.go"},
+		want: `package a
+
+var registry = map[string]int{}
+var a = 2
+var b = 1
+`,
+	},
+	{
+		name: "write",
+		files: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{},
+		after: map[string]string{"a.go": `package a
+
+func a() {}
+
+func b() {}
+`},
+	},
+	{
+		name: "write-serialized",
+		files: map[string]string{
+			"a.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"b.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+		},
+		args: []string{"-j", "1", "-serialize-writes"},
+		after: map[string]string{
+			"a.go": `package a
+
+func a() {}
+
+func b() {}
+`,
+			"b.go": `package a
+
+func a() {}
+
+func b() {}
+`,
+		},
+	},
+	{
+		name: "n",
+		files: map[string]string{
+			"a.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"b.go": `package a
+
+func a() {}
+
+func b() {}
+`,
+			"g.go": `// Code generated by x. DO NOT EDIT.
+
+package a
+
+func b() {}
+
+func a() {}
+`,
+		},
+		args: []string{"-n"},
+		want: `would sort $DIR/a.go: needs reordering
+$DIR/b.go already sorted
+skipping generated $DIR/g.go
+`,
+	},
+	{
+		name: "check",
+		files: map[string]string{
+			"a.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"b.go": `package a
+
+func a() {}
+
+func b() {}
+`,
+		},
+		args: []string{"-check"},
+		want: `$DIR/a.go: needs reordering
+`,
+		fail: true,
+	},
+	{
+		name: "check-sorted",
+		files: map[string]string{"b.go": `package a
+
+func a() {}
+
+func b() {}
+`},
+		args: []string{"-check"},
+	},
+	{
+		name: "check-format-only",
+		files: map[string]string{"a.go": `package a
+
+func a()  {}
+
+func b() {}
+`},
+		args: []string{"-check"},
+		want: `$DIR/a.go: needs formatting
+`,
+		fail: true,
+	},
+	{
+		name: "check-format-and-sort",
+		files: map[string]string{"a.go": `package a
+
+func b()  {}
+
+func a() {}
+`},
+		args: []string{"-check"},
+		want: `$DIR/a.go: needs reordering, needs formatting
+`,
+		fail: true,
+	},
+	{
+		name: "check-spacing",
+		files: map[string]string{"a.go": `package a
+
+func a() {}
+
+// note
+
+func b() {}
+`},
+		args: []string{"-check"},
+		want: `$DIR/a.go: needs comment or spacing changes
+`,
+		fail: true,
+	},
+	{
+		name: "l",
+		files: map[string]string{
+			"a.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"b.go": `package a
+
+func a() {}
+
+func b() {}
+`,
+			"c.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+		},
+		args: []string{"-l"},
+		want: `$DIR/a.go
+$DIR/c.go
+`,
+		fail: true,
+	},
+	{
+		name: "l-0",
+		files: map[string]string{
+			"a.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"b.go": `package a
+
+func a() {}
+
+func b() {}
+`,
+			"c.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+		},
+		args: []string{"-l", "-0"},
+		want: "$DIR/a.go\u0000$DIR/c.go\u0000",
+		fail: true,
+	},
+	{
+		name: "l-0-space",
+		files: map[string]string{
+			"my dir/a b.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"my dir/c.go": `package a
+
+func a() {}
+`,
+		},
+		args: []string{"-l", "-0", "my dir"},
+		want: "$DIR/my dir/a b.go\u0000",
+		fail: true,
+	},
+	{
+		name: "d",
+		files: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-d"},
+		want: `--- $DIR/a.go
++++ $DIR/a.go
+@@ -1,5 +1,5 @@
+ package a
+ 
+-func b() {}
+-
+ func a() {}
++
++func b() {}
+`,
+		after: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+	},
+	{
+		name: "diff-context",
+		files: map[string]string{"a.go": `package a
+
+func f() {}
+
+func g() {}
+
+func h() {}
+
+func i() {}
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-d", "-diff-context", "0"},
+		want: `--- $DIR/a.go
++++ $DIR/a.go
+@@ -2,0 +3,4 @@
++func a() {}
++
++func b() {}
++
+@@ -10,4 +13,0 @@
+-
+-func b() {}
+-
+-func a() {}
+`,
+	},
+	{
+		name: "diff-exit-code",
+		files: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-diff-exit-code"},
+		want: `--- $DIR/a.go
++++ $DIR/a.go
+@@ -1,5 +1,5 @@
+ package a
+ 
+-func b() {}
+-
+ func a() {}
++
++func b() {}
+`,
+		fail: true,
+	},
+	{
+		name: "diff-format-json",
+		files: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-diff-format", "json"},
+		want: `[
+  {
+    "file": "$DIR/a.go",
+    "moves": [
+      {
+        "name": "b",
+        "kind": "func",
+        "fromIndex": 0,
+        "toIndex": 1
+      },
+      {
+        "name": "a",
+        "kind": "func",
+        "fromIndex": 1,
+        "toIndex": 0
+      }
+    ]
+  }
+]
+`,
+	},
+	{
+		name: "diff-format-unknown",
+		files: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-diff-format", "xml"},
+		err:  "unknown diff format: xml",
+	},
+	{
+		name: "results",
+		files: map[string]string{
+			"a.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"b.go": `package a
+
+func a() {}
+
+func b() {}
+`,
+			"bad.go": `package a
+
+func (
+`,
+			"g.go": `// Code generated by x. DO NOT EDIT.
+
+package a
+
+func b() {}
+
+func a() {}
+`,
+		},
+		args: []string{"-check", "-results", "r.json"},
+		want: `$DIR/a.go: needs reordering
+`,
+		after: map[string]string{"r.json": `[
+  {
+    "file": "$DIR/a.go",
+    "status": "unsorted",
+    "reason": "needs reordering"
+  },
+  {
+    "file": "$DIR/b.go",
+    "status": "sorted"
+  },
+  {
+    "file": "$DIR/bad.go",
+    "status": "error",
+    "reason": "$DIR/bad.go:3:8: expected ')', found 'EOF'"
+  },
+  {
+    "file": "$DIR/g.go",
+    "status": "skipped",
+    "reason": "generated"
+  }
+]
+`},
+		err: "sort file $DIR/bad.go error: $DIR/bad.go:3:8: expected ')', found 'EOF'",
+	},
+	{
+		name: "fail-fast",
+		files: map[string]string{
+			"a.go": `package a
+
+func (
+`,
+			"b.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+		},
+		args: []string{"-fail-fast", "-j", "1", "-results", "r.json", "a.go", "b.go"},
+		after: map[string]string{
+			"b.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"r.json": `[
+  {
+    "file": "$DIR/a.go",
+    "status": "error",
+    "reason": "$DIR/a.go:3:8: expected ')', found 'EOF'"
+  }
+]
+`,
+		},
+		err: "sort file $DIR/a.go error: $DIR/a.go:3:8: expected ')', found 'EOF'",
+	},
+	{
+		name: "jobs",
+		files: map[string]string{
+			"a.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"b.go": `package a
+
+func a() {}
+
+func b() {}
+`,
+			"c.go": `package a
+func {
+`,
+			"d.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"e.go": `package a
+
+func a() {}
+
+func b() {}
+`,
+			"f.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"g.go": `package a
+
+var {
+`,
+			"h.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+		},
+		args: []string{"-j", "4", "-check", "."},
+		want: `$DIR/a.go: needs reordering
+$DIR/d.go: needs reordering
+$DIR/f.go: needs reordering
+$DIR/h.go: needs reordering
+`,
+		err: `sort file $DIR/c.go error: $DIR/c.go:2:6: expected 'IDENT', found '{'
+sort file $DIR/g.go error: $DIR/g.go:3:5: expected 'IDENT', found '{'`,
+	},
+	{
+		name: "impact",
+		files: map[string]string{
+			"a.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"b.go": `package a
+
+func a() {}
+
+func b() {}
+`,
+		},
+		args: []string{"-impact"},
+		want: `files checked: 2
+files changed: 1
+declarations moved: 2
+largest diff: $DIR/a.go (2 declarations moved)
+`,
+	},
+	{
+		name: "dry-run",
+		files: map[string]string{
+			"a.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"b.go": `package a
+
+func a() {}
+
+func b() {}
+`,
+		},
+		args: []string{"-dry-run"},
+		want: `would write $DIR/a.go
+`,
+		after: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+	},
+	{
+		name: "dry-run-out-dir",
+		files: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-dry-run", "-out-dir", "out"},
+		want: `would write out/a.go
+`,
+	},
+	{
+		name: "fail-fast-jobs",
+		files: map[string]string{
+			"a.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"b.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"c.go": `package a
+
+func (
+`,
+			"d.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"e.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"f.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"g.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"h.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+		},
+		args: []string{"-fail-fast", "-j", "4", "-check"},
+		want: `$DIR/a.go: needs reordering
+$DIR/b.go: needs reordering
+`,
+		err: "sort file $DIR/c.go error: $DIR/c.go:3:8: expected ')', found 'EOF'",
+	},
+	{
+		name: "out-dir",
+		files: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-out-dir", "out", "-out-mode", "0600"},
+		after: map[string]string{
+			"a.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"out/a.go": `package a
+
+func a() {}
+
+func b() {}
+`,
+		},
+	},
+	{
+		name: "out-mode-invalid",
+		files: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-out-dir", "out", "-out-mode", "999"},
+		err:  "invalid -out-mode: 999",
+	},
+	{
+		name: "jobs-invalid",
+		files: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-j", "0"},
+		err:  "-j must be at least 1: 0",
+	},
+	{
+		name: "diff-context-invalid",
+		files: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-d", "-diff-context", "-1"},
+		err:  "negative diff context: -1",
+	},
+	{
+		name: "verify",
+		files: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-verify"},
+		after: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+	},
+	{
+		name: "require-doc",
+		files: map[string]string{"a.go": `package a
+
+func A() {}
+
+// B is documented
+func B() {}
+
+func c() {}
+`},
+		args: []string{"-require-doc"},
+		want: `$DIR/a.go:3:1: exported func A has no doc comment
+`,
+		fail: true,
+	},
+	{
+		name: "report-comments",
+		files: map[string]string{"a.go": `package a
+
+func b() {}
+
+// floating
+
+func a() {}
+`},
+		args: []string{"-report-comments"},
+		want: `$DIR/a.go:5: comment "// floating" moves to line 3
+`,
+	},
+	{
+		name: "safe",
+		files: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-safe"},
+		after: map[string]string{"a.go": `package a
+
+func a() {}
+
+func b() {}
+`},
+	},
+	{
+		name:  "between",
+		files: map[string]string{"README.md": "text\n\n```go\npackage a\n\nfunc b() {}\n\nfunc a() {}\n```\n\nmore\n"},
+		args:  []string{"-between", "```go,```", "README.md"},
+		after: map[string]string{"README.md": "text\n\n```go\npackage a\n\nfunc a() {}\n\nfunc b() {}\n```\n\nmore\n"},
+	},
+	{
+		name: "between-invalid",
+		files: map[string]string{"a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-between", "```go"},
+		err:  "-between needs a START,END pair of markers: ```go",
+	},
+	{
+		name: "protect-vendor",
+		files: map[string]string{"vendor/x/a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-protect-vendor", "-l", "."},
+		err:  "$DIR/vendor/x/a.go is vendored, refusing to sort it with -protect-vendor",
+	},
+	{
+		name: "stdin",
+		args: []string{"-stdin-filename", "x.go"},
+		stdin: `package a
+
+func b() {}
+
+func a() {}
+`,
+		want: `package a
+
+func a() {}
+
+func b() {}
+`,
+	},
+	{
+		name: "protect-vendor-root",
+		files: map[string]string{"vendor/x/a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-protect-vendor", "-l", "vendor/x"},
+		err:  "$DIR/vendor/x/a.go is vendored, refusing to sort it with -protect-vendor",
+	},
+	{
+		name: "protect-vendor-pattern",
+		files: map[string]string{"vendor/x/a.go": `package a
+
+func b() {}
+
+func a() {}
+`},
+		args: []string{"-protect-vendor", "-l", "./vendor/..."},
+		err:  "$DIR/vendor/x/a.go is vendored, refusing to sort it with -protect-vendor",
+	},
+	{
+		name: "protect-vendor-outside",
+		files: map[string]string{
+			"a.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"vendor/x/a.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+		},
+		args: []string{"-protect-vendor", "-l", "a.go"},
+		want: `$DIR/a.go
+`,
+		fail: true,
+	},
+	{
+		name: "stdin-local",
+		files: map[string]string{"go.mod": `module example.com/m
+
+go 1.21
+`},
+		args: []string{"-stdin-filename", "x.go", "-group-imports"},
+		stdin: `package a
+
+import (
+	"example.com/m/x"
+	"github.com/a/b"
+	"fmt"
+)
+
+var _ = fmt.Sprint(x.A, b.B)
+`,
+		want: `package a
+
+import (
+	"fmt"
+
+	"github.com/a/b"
+
+	"example.com/m/x"
+)
+
+var _ = fmt.Sprint(x.A, b.B)
+`,
+	},
+	{
+		name: "exclude",
+		files: map[string]string{
+			"a.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"gen/b.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+		},
+		args: []string{"-exclude", "gen", "-l"},
+		want: `$DIR/a.go
+`,
+		fail: true,
+	},
+	{
+		name: "verify-keep-value-runs",
+		files: map[string]string{"a.go": `package a
+
+var z = 1
+
+// run
+const y = 1
+var x = 2
+
+const a = 3
+`},
+		args: []string{"-verify", "-keep-value-runs"},
+	},
+	{
+		name: "safe-sort-struct-fields",
+		files: map[string]string{"a.go": `package a
+
+type T struct {
+	b int
+	a int
+}
+`},
+		args: []string{"-safe", "-sort-struct-fields", "a.go"},
+		after: map[string]string{"a.go": `package a
+
+type T struct {
+	b int
+	a int
+}
+`},
+		err: "sort file $DIR/a.go error: declaration dropped by sort: type T struct {",
+	},
+	{
+		name: "dots",
+		files: map[string]string{
+			"a.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"sub/b.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+		},
+		args: []string{"-l", "./..."},
+		want: `$DIR/a.go
+$DIR/sub/b.go
+`,
+		fail: true,
+	},
+	{
+		name: "manifest",
+		files: map[string]string{
+			"a.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"b.go": `package a
+
+func b() {}
+
+func a() {}
+`,
+			"m.json": "{\"files\": [\"a.go\"]}",
+		},
+		args: []string{"-l", "-manifest", "m.json"},
+		want: `$DIR/a.go
+`,
+		fail: true,
+	},
+	{
+		name: "diff-scope",
+		files: map[string]string{
+			"a.go": `package a
+
+func a() {}
+
+func c() {}
+
+func b() {}
+`,
+			"d.diff": `--- a/a.go
++++ b/a.go
+@@ -5,0 +6,2 @@
++
++func c() {}
+--- a/x/b.go
++++ b/x/b.go
+@@ -5,0 +6,2 @@
++
++func c() {}
+--- a/g.go
++++ b/g.go
+@@ -7,0 +8,2 @@
++
++func c() {}
+`,
+			"g.go": `// Code generated by x. DO NOT EDIT.
+
+package a
+
+func a() {}
+
+func c() {}
+
+func b() {}
+`,
+			"x/b.go": `package a
+
+func a() {}
+
+func c() {}
+
+func b() {}
+`,
+		},
+		args: []string{"-diff-scope", "d.diff", "-exclude", "x"},
+		want: `a.go:7:1: b is out of order with c
+`,
+		fail: true,
+	},
+	{
+		name: "diff-scope-stdin",
+		files: map[string]string{"a.go": `package a
+
+func a() {}
+
+func c() {}
+
+func b() {}
+`},
+		args: []string{"-diff-scope", "-"},
+		stdin: `--- a/a.go
++++ b/a.go
+@@ -5,0 +6,2 @@
++
++func c() {}
+`,
+		want: `a.go:7:1: b is out of order with c
+`,
+		fail: true,
+	},
+}
+
+func BenchmarkGetDirGoFiles(b *testing.B) {
+	//a chain of 100 nested directories, each with two files to sort and two to skip
+	dir, err := filepath.EvalSymlinks(b.TempDir())
+	if err != nil {
+		b.Fatal(err)
+	}
+	path := dir
+	for depth := 0; depth < 100; depth++ {
+		path = filepath.Join(path, fmt.Sprintf("d%d", depth))
+		if err = os.MkdirAll(path, 0755); err != nil {
+			b.Fatal(err)
+		}
+		for _, name := range []string{"a.go", "b.go", "a_test.go", "README.md"} {
+			if err = os.WriteFile(filepath.Join(path, name), []byte("package a\n"), 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	//Walk is the lstat of every entry getDirGoFiles did before it used WalkDir
+	b.Run("Walk", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var files []string
+			_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() && strings.HasSuffix(path, ".go") && !strings.Contains(path, "_test.go") {
+					files = append(files, path)
+				}
+				return nil
+			})
+			if len(files) != 200 {
+				b.Fatalf("got %d files, want 200", len(files))
+			}
+		}
+	})
+	b.Run("WalkDir", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if files := getDirGoFiles(dir); len(files) != 200 {
+				b.Fatalf("got %d files, want 200", len(files))
+			}
+		}
+	})
+}
+
+func TestFlags(t *testing.T) {
+	for _, c := range flagCases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := writeFiles(t, c.files)
+			stdout, fail, err := runGoSort(t, dir, c.stdin, c.args...)
+			var got string
+			if err != nil {
+				got = strings.ReplaceAll(err.Error(), dir, "$DIR")
+			}
+			if got != c.err {
+				t.Fatalf("error:\n%s\nwant:\n%s", got, c.err)
+			}
+			if c.err == "" && fail != c.fail {
+				t.Errorf("fail: %v, want %v", fail, c.fail)
+			}
+			if got := strings.ReplaceAll(stdout, dir, "$DIR"); got != c.want {
+				t.Errorf("stdout:\n%s\nwant:\n%s", got, c.want)
+			}
+			for name, want := range c.after {
+				content, e := os.ReadFile(filepath.Join(dir, name))
+				if e != nil {
+					t.Errorf("read %s: %v", name, e)
+					continue
+				}
+				if got := strings.ReplaceAll(string(content), dir, "$DIR"); got != want {
+					t.Errorf("%s:\n%s\nwant:\n%s", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetModulePath(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"go.mod":         "// the module\nmodule \"example.com/m\" // quoted\n\ngo 1.21\n",
+		"a.go":           "package m\n",
+		"sub/b.go":       "package sub\n",
+		"nested/go.mod":  "module example.com/nested\n",
+		"nested/x/c.go":  "package x\n",
+		"modules/go.mod": "go 1.21\n",
+		"modules/d.go":   "package modules\n",
+	})
+	for file, want := range map[string]string{
+		"a.go":          "example.com/m",
+		"sub/b.go":      "example.com/m",
+		"nested/x/c.go": "example.com/nested",
+		"modules/d.go":  "",
+	} {
+		if got := getModulePath(filepath.Join(dir, file)); got != want {
+			t.Errorf("getModulePath(%s) = %q, want %q", file, got, want)
+		}
+	}
+}
+
+func TestIsVendorPath(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"vendor/x/a.go": "package x\n",
+		"b.go":          "package b\n",
+	})
+	for _, c := range []struct {
+		root, file string
+		want       bool
+	}{
+		{dir, filepath.Join(dir, "vendor/x/a.go"), true},
+		{filepath.Join(dir, "vendor"), filepath.Join(dir, "vendor/x/a.go"), true},
+		{filepath.Join(dir, "vendor/x"), filepath.Join(dir, "vendor/x/a.go"), true},
+		{dir, filepath.Join(dir, "b.go"), false},
+		{filepath.Join(dir, "b.go"), filepath.Join(dir, "vendor/x/a.go"), true},
+	} {
+		if got := isVendorPath(c.root, c.file); got != c.want {
+			t.Errorf("isVendorPath(%s, %s) = %v, want %v", c.root, c.file, got, c.want)
+		}
+	}
+}
+
+func TestParseDiffLines(t *testing.T) {
+	diff := "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\t2024-01-01\n@@ -1,2 +1,3 @@\n+x\n@@ -9 +10 @@ func a() {\n@@ -20,3 +21,0 @@\n--- a/gone.go\n+++ /dev/null\n@@ -1,3 +0,0 @@\n"
+	want := map[string][][2]int{"a.go": {{1, 3}, {10, 10}, {21, 22}}}
+	if got := parseDiffLines([]byte(diff)); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDiffLines = %v, want %v", got, want)
+	}
+}
+
+func TestSortActionByFilename(t *testing.T) {
+	sorter, err := gosort.NewSorter(flagOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name, src string
+		changed   bool
+	}{
+		{name: "sorted", src: "package a\n\nfunc a() {}\n\nfunc b() {}\n"},
+		{name: "reordered", src: "package a\n\nfunc b() {}\n\nfunc a() {}\n", changed: true},
+		{name: "reformatted", src: "package a\n\nfunc a()  {}\n", changed: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			file := filepath.Join(writeFiles(t, map[string]string{"a.go": tc.src}), "a.go")
+			var buf bytes.Buffer
+			res, err := sortActionByFilename(sorter, &buf, file, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.changed() != tc.changed {
+				t.Errorf("changed: %v, want %v", res.changed(), tc.changed)
+			}
+			content, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rewritten := string(content) != tc.src; rewritten != tc.changed {
+				t.Errorf("rewritten: %v, want %v", rewritten, tc.changed)
+			}
+		})
+	}
+}
+
+func TestSortTargetsPanic(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.go": "package a\n\nfunc boom() {}\n",
+		"b.go": "package a\n\nfunc b() {}\n\nfunc a() {}\n",
+	})
+	//a panic in the hook stands for an unexpected AST shape, it is raised while a.go is sorted
+	sorter, err := gosort.NewSorter(gosort.Options{OnDecl: func(info gosort.DeclInfo) {
+		if info.Name == "boom" {
+			panic("unexpected declaration")
+		}
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := sortTargets(sorter, []targetFile{{Root: dir, File: filepath.Join(dir, "a.go")}, {Root: dir, File: filepath.Join(dir, "b.go")}})
+	if err = jobs[0].err; err == nil || !strings.HasPrefix(err.Error(), "panic while sorting "+filepath.Join(dir, "a.go")+": unexpected declaration") {
+		t.Errorf("a.go: got %v, want the panic as its error", err)
+	}
+	if !jobs[1].done || jobs[1].err != nil {
+		t.Fatalf("b.go: done %v, error %v", jobs[1].done, jobs[1].err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "b.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "package a\n\nfunc a() {}\n\nfunc b() {}\n"; string(content) != want {
+		t.Errorf("b.go: got\n%s\nwant\n%s", content, want)
+	}
+}
+
+func TestVersionInfo(t *testing.T) {
+	got := versionInfo()
+	if !strings.HasPrefix(got, "version ") || !strings.Contains(got, "\ngo "+runtime.Version()+"\n") {
+		t.Errorf("got %q, want the version and the go version", got)
+	}
+}
+
+func TestWriteKeepsMode(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.go": "package a\n\nfunc b() {}\n\nfunc a() {}\n"})
+	file := filepath.Join(dir, "a.go")
+	if err := os.Chmod(file, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runGoSort(t, dir, "", "a.go"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("got mode %v, want -rw-------", info.Mode().Perm())
+	}
+	if content, _ := os.ReadFile(file); string(content) != "package a\n\nfunc a() {}\n\nfunc b() {}\n" {
+		t.Errorf("not sorted:\n%s", content)
+	}
+}
+
+func TestWriteKeepsMtime(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.go": "package a\n\nfunc b() {}\n\nfunc a() {}\n"})
+	file := filepath.Join(dir, "a.go")
+	if _, _, err := runGoSort(t, dir, "", "a.go"); err != nil {
+		t.Fatal(err)
+	}
+	//an old mtime, a rewrite within the timestamp granularity would go unnoticed otherwise
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(file, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runGoSort(t, dir, "", "a.go"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Errorf("the sorted file was rewritten, mtime %v, want %v", info.ModTime(), old)
+	}
+}
+
+// runGoSort runs go-sort with args in dir like main, it returns the standard output
+func runGoSort(t *testing.T, dir, stdin string, args ...string) (stdout string, fail bool, err error) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+	defer func() {
+		//the flags of go test itself stay set
+		flag.VisitAll(func(f *flag.Flag) {
+			if !strings.HasPrefix(f.Name, "test.") {
+				f.Value.Set(f.DefValue)
+			}
+		})
+		excludeFlag = nil
+		*conf = config{}
+	}()
+	if err = flag.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	if stdin != "" {
+		in, e := os.Open(filepath.Join(writeFiles(t, map[string]string{"stdin": stdin}), "stdin"))
+		if e != nil {
+			t.Fatal(e)
+		}
+		defer func(stdin *os.File) { os.Stdin = stdin }(os.Stdin)
+		os.Stdin = in
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := make(chan string)
+	go func() {
+		content, _ := io.ReadAll(r)
+		output <- string(content)
+	}()
+	defer func(stdout *os.File) { os.Stdout = stdout }(os.Stdout)
+	os.Stdout = w
+	needSort, err := func() (bool, error) {
+		defer w.Close()
+		if e := loadConfig(*configFlag); e != nil {
+			return false, e
+		}
+		sorter, e := gosort.NewSorter(flagOptions())
+		if e != nil {
+			return false, e
+		}
+		return sortFile(sorter)
+	}()
+	return <-output, shouldFail(needSort), err
+}
+
+// writeFiles writes the files into a new temporary directory and returns it
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
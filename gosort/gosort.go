@@ -0,0 +1,2547 @@
+// Package gosort sorts the declarations of go sources, it is the library behind the go-sort command
+package gosort
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/scanner"
+	"go/token"
+	"path"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// PublicMarker separates exported declarations above it from unexported ones below it
+const PublicMarker = "// gosort:public"
+
+// SortedMarker tells readers that the declaration order is managed by go-sort
+const SortedMarker = "// sorted by go-sort"
+const (
+	// floatingComment is between declarations, it is written after the imports unless it is attached to a declaration
+	floatingComment commentKind = iota
+	// packageDocComment is the doc of the package clause, copied by writePkg
+	packageDocComment
+	// beforePackageComment starts before the end of the package line, e.g. a license or build constraints, copied by writePkg
+	beforePackageComment
+	// docComment is the doc of a declaration, written with it
+	docComment
+	// bodyComment is inside a declaration, e.g. in a function body or a parenthesized block, written with it
+	bodyComment
+	// trailingComment is on the line a declaration ends, right after it, written with it
+	trailingComment
+	// nolintComment is a file level //nolint directive, it stays below the package clause
+	nolintComment
+	// markerComment is the public or the sorted marker
+	markerComment
+	// anchorComment is an anchor comment, it keeps its place
+	anchorComment
+	// eofComment is after the last declaration, e.g. a commented-out function, it is written at the end of the file
+	eofComment
+)
+
+// DeclInfo describes a declaration written by a sort
+type DeclInfo struct {
+	// Kind and Name are the ones returned by DeclKindName
+	Kind, Name string
+}
+
+// Disorder is a declaration out of order with one of its neighbors in the source
+type Disorder struct {
+	// Position is where the declaration starts
+	Position token.Position
+	// Name and Neighbor are named by DeclKindName
+	Name, Neighbor string
+}
+
+// Options configures the order of the sorted declarations
+type Options struct {
+	// Anchor is the text of the floating comments that keep their place, declarations sort around them without crossing
+	Anchor string
+	// AssociateFuncs lists glob patterns where {type} stands for a type name, e.g. New{type} or {type}From*,
+	// a free function matching a type of the file is written after the methods of that type
+	AssociateFuncs []string
+	// BlankDecls places the declarations of the blank identifier, e.g. var _ Interface = (*T)(nil), in their section:
+	// sorted as the name _ when empty, bottom writes them last, source keeps their index in the section,
+	// they keep their relative source order in every case
+	BlankDecls string
+	// CaseInsensitive compares names by their lowercase form, names equal that way are ordered by their bytes,
+	// so Apple comes before apple, the export tier still comes first
+	CaseInsensitive bool
+	// Collate sorts names with the unicode collation of this locale, e.g. und, fr, de, instead of their bytes
+	Collate string
+	// EnumCluster writes the String method of a type right after its first const block, with the consts and vars it uses,
+	// e.g. the tables generated by stringer
+	EnumCluster bool
+	// Enforce lists the sections (const, var, type, func) whose declarations are sorted, the other sections keep
+	// the source order of their declarations, all sections are sorted when empty,
+	// the methods written after their type belong to the type section
+	Enforce []string
+	// ErrorPatterns lists the glob patterns of error sentinel names written with a type, {type} stands for its name,
+	// Err{type}* and err{type}* when empty
+	ErrorPatterns []string
+	// ErrorsWithType writes the error sentinel vars of a type right after the type
+	ErrorsWithType bool
+	// ExportFirst limits the kinds (const, var, type, func, method) where exported names come first, all kinds when empty,
+	// the other kinds are compared case-insensitively so exported names are not bucketed by their uppercase letter
+	ExportFirst []string
+	// GroupFuncVars writes the function typed vars as a block of their own after the other vars
+	GroupFuncVars bool
+	// GroupImports splits the specs of parenthesized import blocks into the standard library, third-party and local
+	// groups, separated by a blank line, like goimports does
+	GroupImports bool
+	// GroupOrphanMethods writes the methods whose receiver type is declared in another file after the functions,
+	// grouped by receiver type and sorted by name in each group
+	GroupOrphanMethods bool
+	// HelpersAfterCallers writes an unexported function used by a single exported function right after it
+	HelpersAfterCallers bool
+	// ImplMethodsFirst names an interface of the file, the methods of a type implementing it come first,
+	// in the order of the interface, before the other methods
+	ImplMethodsFirst string
+	// KeepBlankLines carries the blank lines above a declaration in the source with it, so the declarations of a section
+	// are separated like they were, gofmt still collapses several blank lines into one
+	KeepBlankLines bool
+	// KeepValueRuns keeps a documented run of adjacent const and var declarations together in the const section
+	KeepValueRuns bool
+	// LocalPrefix is the import path prefix of the local group of GroupImports, e.g. github.com/org/project,
+	// see Sorter.ForModule
+	LocalPrefix string
+	// MainFirst writes func main before any init function
+	MainFirst bool
+	// Marker ensures a sorted marker comment at the top or the bottom of the file, top, bottom or empty
+	Marker string
+	// MethodSort is the order of the methods of a type, name or arity, arity puts methods with fewer parameters first
+	// and sorts the methods with as many parameters by name, name when empty
+	MethodSort string
+	// OnDecl is called with every declaration of the sorted source, in the order they are written
+	OnDecl func(info DeclInfo)
+	// OnlyMethodsOf only sorts the methods of this type, everything else keeps its source order
+	OnlyMethodsOf string
+	// PreserveOrderFor lists names or glob patterns whose declarations keep their relative source order
+	PreserveOrderFor []string
+	// Priority lists names or glob patterns written first in every section, in this order,
+	// e.g. a registry or lookup table var to lead the var section
+	Priority []string
+	// SeparateMethods writes the methods among the functions instead of right after their type
+	SeparateMethods bool
+	// SortWithinBlocks sorts the specs of parenthesized const and var blocks by name, a blank line or a floating comment
+	// ends the run of specs sorted together, blocks using iota or implicit repetition are kept as is
+	SortWithinBlocks bool
+	// SortInterfaces sorts the methods of interfaces by name, constraint interfaces are kept as is
+	SortInterfaces bool
+	// SortStructFields sorts the fields of structs by name, exported fields first, embedded fields by their type name,
+	// a struct whose field order matters, e.g. for its memory layout, opts out with //go-sort:no-field-sort,
+	// a struct used in an unkeyed composite literal, e.g. T{1, 2}, is kept as is.
+	// The field order is part of the type identity: a struct assigned or converted to an identical struct type,
+	// e.g. of another package, no longer compiles once sorted, VerifyDecls reports every reordered struct
+	SortStructFields bool
+	// StripPrefix and StripSuffix list name affixes ignored when sorting
+	StripPrefix, StripSuffix []string
+	// StripWS trims trailing whitespace from every output line
+	StripWS bool
+	// Warnf reports what a sort changed that a reader may not expect, warnings are dropped when nil
+	Warnf func(format string, args ...any)
+
+	// collator is compiled from Collate
+	collator *lockedCollator
+	// unkeyed are the names of the structs used in an unkeyed composite literal of the other files, see Sorter.ForPackage
+	unkeyed []string
+	// tested are the names of the declarations of the source tested by the sorted file, in their order, see Sorter.ForTest
+	tested []string
+}
+
+// compile validates the options and builds the state they share between sorts
+func (o *Options) compile() (err error) {
+	if o.Marker != "" && o.Marker != "top" && o.Marker != "bottom" {
+		return fmt.Errorf("unknown marker location: %s", o.Marker)
+	}
+	for _, kind := range o.Enforce {
+		if kind != "const" && kind != "var" && kind != "type" && kind != "func" {
+			return fmt.Errorf("unknown section to enforce: %s", kind)
+		}
+	}
+	if o.BlankDecls != "" && o.BlankDecls != "bottom" && o.BlankDecls != "source" {
+		return fmt.Errorf("unknown blank declarations placement: %s", o.BlankDecls)
+	}
+	if o.MethodSort != "" && o.MethodSort != "name" && o.MethodSort != "arity" {
+		return fmt.Errorf("unknown method sort: %s", o.MethodSort)
+	}
+	if o.Collate != "" && o.collator == nil {
+		tag, e := language.Parse(o.Collate)
+		if e != nil {
+			return fmt.Errorf("unknown collate locale %s: %w", o.Collate, e)
+		}
+		o.collator = &lockedCollator{collator: collate.New(tag)}
+	}
+	return
+}
+
+// Plan is the order a sort would write the declarations in, section by section
+type Plan struct {
+	Sections []PlanSection `json:"sections"`
+}
+
+// PlanSection is a section of a Plan
+type PlanSection struct {
+	// Kind is main, const, var, type or func, marker for the public marker
+	Kind string `json:"kind"`
+	// Names are the declarations in their sorted order, a method is named Type.Method and follows its type,
+	// a declaration with several specs is named by all of them, separated by commas
+	Names []string `json:"names"`
+}
+
+// Sorter sorts sources with the same options, it is safe for concurrent use
+type Sorter struct {
+	opts Options
+}
+
+// ForModule returns a Sorter for a file of the module with this path, with GroupImports and no LocalPrefix
+// the imports of the module are the local group
+func (s *Sorter) ForModule(modulePath string) *Sorter {
+	t := &Sorter{opts: s.opts}
+	if t.opts.LocalPrefix == "" {
+		t.opts.LocalPrefix = modulePath
+	}
+	return t
+}
+
+// ForPackage returns a Sorter for a file of the package whose other files are given by their names, with SortStructFields
+// the fields of a struct used in an unkeyed composite literal of any of them keep their order
+func (s *Sorter) ForPackage(files map[string][]byte) (*Sorter, error) {
+	var parsed []*ast.File
+	for name, file := range files {
+		f, err := parser.ParseFile(token.NewFileSet(), name, file, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, f)
+	}
+	t := &Sorter{opts: s.opts}
+	t.opts.unkeyed = getUnkeyedStructs(parsed...)
+	return t, nil
+}
+
+// ForTest returns a Sorter for the test file of the tested source, its tests, benchmarks, fuzz tests and examples
+// follow the order the sort writes the declarations they test in, e.g. TestFoo and TestFoo_bar the place of Foo,
+// TestT_M the one of T.M, the other functions are sorted as usual
+func (s *Sorter) ForTest(tested []byte) (*Sorter, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), "", tested, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	t := &Sorter{opts: s.opts}
+	t.opts.tested = nil
+	var decls []ast.Decl
+	for _, section := range getDeclSections(f, tested, &t.opts) {
+		for _, node := range section.List {
+			decls = append(append(decls, node.Decl), node.Group...)
+		}
+	}
+	for _, decl := range decls {
+		switch _decl := decl.(type) {
+		case *ast.FuncDecl:
+			if _decl.Recv != nil {
+				t.opts.tested = append(t.opts.tested, getFuncReceiverTypeName(_decl)+"_"+_decl.Name.Name)
+			} else {
+				t.opts.tested = append(t.opts.tested, _decl.Name.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range _decl.Specs {
+				if _spec, ok := spec.(*ast.TypeSpec); ok {
+					t.opts.tested = append(t.opts.tested, _spec.Name.Name)
+				}
+			}
+		}
+	}
+	return t, nil
+}
+
+// OutOfOrder returns the declarations selected by touched, from their first and last lines,
+// that are out of order with a neighbor of the source
+func (s *Sorter) OutOfOrder(filename string, src []byte, touched func(start, end int) bool) (disorders []Disorder, err error) {
+	fSet := token.NewFileSet()
+	f, err := parser.ParseFile(fSet, filename, src, parser.ParseComments)
+	if err != nil {
+		return
+	}
+	check := func(sorted []ast.Decl) {
+		//the neighbors of a declaration are the ones next to it in the source
+		source := slices.Clone(sorted)
+		sort.Slice(source, func(i, j int) bool { return source[i].Pos() < source[j].Pos() })
+		for i, decl := range source {
+			if !touched(fSet.Position(decl.Pos()).Line, fSet.Position(decl.End()).Line) {
+				continue
+			}
+			at := slices.Index(sorted, decl)
+			for _, neighbor := range []int{i - 1, i + 1} {
+				if neighbor < 0 || neighbor >= len(source) {
+					continue
+				}
+				if (neighbor < i) != (slices.Index(sorted, source[neighbor]) < at) {
+					_, name := DeclKindName(decl)
+					_, other := DeclKindName(source[neighbor])
+					disorders = append(disorders, Disorder{Position: fSet.Position(decl.Pos()), Name: name, Neighbor: other})
+					break
+				}
+			}
+		}
+	}
+	for _, section := range getDeclSections(f, src, &s.opts) {
+		var decls []ast.Decl
+		for _, node := range section.List {
+			decls = append(decls, node.Decl)
+			if len(node.Group) > 1 {
+				check(node.Group)
+			}
+		}
+		check(decls)
+	}
+	return
+}
+
+// Sort returns the sorted source and whether it differs from src
+func (s *Sorter) Sort(src []byte) (out []byte, changed bool, err error) {
+	if out, err = s.SortSource("", src); err != nil {
+		return nil, false, err
+	}
+	return out, !bytes.Equal(out, src), nil
+}
+
+// SortSource returns the sorted content of a go file, filename is only used in positions and errors
+func (s *Sorter) SortSource(filename string, content []byte) (out []byte, err error) {
+	fSet := token.NewFileSet()
+	var f *ast.File
+	//an unexpected AST shape must not crash a whole run, report it as an error of this file
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, fmt.Errorf("panic while sorting %s: %v\n%s", filename, r, stackSnippet(debug.Stack()))
+			return
+		}
+		//only a file the sort changes is warned about, so an already sorted file stays quiet on every run
+		if err == nil && s.opts.Warnf != nil && !bytes.Equal(out, content) {
+			warnEmptyDecls(fSet, f, s.opts.Warnf)
+		}
+	}()
+	if f, err = parser.ParseFile(fSet, filename, content, parser.ParseComments); err != nil {
+		return
+	}
+	opts := &s.opts
+	if opts.SortStructFields {
+		_opts := *opts
+		_opts.unkeyed = append(slices.Clone(opts.unkeyed), getUnkeyedStructs(f)...)
+		opts = &_opts
+		if opts.Warnf != nil {
+			warnUnkeyedStructs(fSet, f, content, opts.unkeyed, opts.Warnf)
+		}
+	}
+	//groupImports copies the import specs at their source positions, format.Source sorts them afterwards
+	if !opts.GroupImports {
+		ast.SortImports(fSet, f)
+	}
+	if opts.OnlyMethodsOf != "" {
+		return format.Source(sortOnlyMethodsOf(f, content, opts.OnlyMethodsOf, opts))
+	}
+	if isAlreadySorted(fSet, f, content, opts) {
+		for _, decl := range f.Decls {
+			notifyDecl(decl, opts)
+		}
+		return format.Source(content)
+	}
+	var buf = new(bytes.Buffer)
+	writePkg(buf, fSet, f, content)
+	if opts.Marker == "top" {
+		buf.WriteString(SortedMarker + "\n\n")
+	}
+	if err = write2buf(buf, fSet, f, content, opts); err != nil {
+		return
+	}
+	if opts.Marker == "bottom" {
+		buf.WriteString("\n" + SortedMarker + "\n")
+		var ret []byte
+		if ret, err = format.Source(buf.Bytes()); err != nil {
+			return
+		}
+		buf.Reset()
+		buf.Write(ret)
+	}
+	if opts.StripWS {
+		return stripTrailingWhitespace(buf.Bytes()), nil
+	}
+	return buf.Bytes(), nil
+}
+
+// commentKind is the category of a comment group, every group of a file has exactly one, see getCommentKinds
+type commentKind int
+
+// declFilter selects declarations by name or position, a nil filter selects all of them
+type declFilter func(name string, decl ast.Decl) bool
+
+func (d declFilter) match(name string, decl ast.Decl) bool { return d == nil || d(name, decl) }
+
+// declSection is a section of the sorted output
+type declSection struct {
+	// Kind is main, const, var, type or func, marker for the public marker
+	Kind string
+	List letterDeclList
+	// Marker is the public marker comment written as the marker section
+	Marker *ast.CommentGroup
+}
+
+// fileComments is the classification of the comment groups of a file and the floating ones attached to each declaration
+type fileComments struct {
+	Attached   map[ast.Decl][]*ast.CommentGroup
+	IsAttached map[*ast.CommentGroup]bool
+	Kinds      map[*ast.CommentGroup]commentKind
+}
+
+// letterDecl is a letter and its declaration
+type letterDecl struct {
+	Letter string
+	// Name is the declaration name, Letter is derived from it
+	Name string
+	// Kind is the declaration kind: const, var, type, func or method
+	Kind string
+	// Rank is the index of the first matching priority pattern, lower ranks are written first
+	Rank int
+	// Tier puts unexported names after exported ones, only for the kinds listed by Options.ExportFirst if any
+	Tier int
+	// Fold compares names case-insensitively first, with Options.CaseInsensitive or for the kinds not listed by Options.ExportFirst
+	Fold bool
+	// Key is the collation key of Letter with Options.Collate, names are compared by their bytes without it
+	Key  []byte
+	Decl ast.Decl
+	// Group is written right after Decl as an atomic unit
+	Group []ast.Decl
+}
+
+// letterDeclList is a list of letterDecl
+type letterDeclList []letterDecl
+
+func (l letterDeclList) Len() int { return len(l) }
+
+// Less orders by priority rank, then by tier, then by collation key if any,
+// then by name, case-insensitively first for folded declarations,
+// then by source position, so declarations sharing a name, e.g. var _ = ..., keep their order
+func (l letterDeclList) Less(i, j int) bool {
+	if l[i].Rank != l[j].Rank {
+		return l[i].Rank < l[j].Rank
+	}
+	if l[i].Tier != l[j].Tier {
+		return l[i].Tier < l[j].Tier
+	}
+	if l[i].Key != nil && l[j].Key != nil {
+		if c := bytes.Compare(l[i].Key, l[j].Key); c != 0 {
+			return c < 0
+		}
+		return l[i].Decl.Pos() < l[j].Decl.Pos()
+	}
+	if l[i].Fold || l[j].Fold {
+		if c := strings.Compare(strings.ToLower(l[i].Letter), strings.ToLower(l[j].Letter)); c != 0 {
+			return c < 0
+		}
+	}
+	if l[i].Letter != l[j].Letter {
+		return l[i].Letter < l[j].Letter
+	}
+	return l[i].Decl.Pos() < l[j].Decl.Pos()
+}
+
+func (l letterDeclList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+
+// lockedCollator is a collator safe for concurrent use
+type lockedCollator struct {
+	mu       sync.Mutex
+	collator *collate.Collator
+	buf      collate.Buffer
+}
+
+// key returns the collation key of a name
+func (c *lockedCollator) key(name string) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := bytes.Clone(c.collator.KeyFromString(&c.buf, name))
+	c.buf.Reset()
+	return key
+}
+
+// DeclKindName returns the kind and the name of a declaration,
+// the name of a method is prefixed by its receiver type, a group is named by all its specs
+func DeclKindName(decl ast.Decl) (kind, name string) {
+	switch _decl := decl.(type) {
+	case *ast.FuncDecl:
+		if _decl.Recv != nil {
+			return "method", getFuncReceiverTypeName(_decl) + "." + _decl.Name.Name
+		}
+		return "func", _decl.Name.Name
+	case *ast.GenDecl:
+		names := make([]string, 0, len(_decl.Specs))
+		for _, spec := range _decl.Specs {
+			switch _spec := spec.(type) {
+			case *ast.ImportSpec:
+				names = append(names, _spec.Path.Value)
+			case *ast.ValueSpec:
+				for _, name := range _spec.Names {
+					names = append(names, name.Name)
+				}
+			case *ast.TypeSpec:
+				names = append(names, _spec.Name.Name)
+			}
+		}
+		return _decl.Tok.String(), strings.Join(names, ",")
+	}
+	return "", ""
+}
+
+// NewSorter returns a Sorter with the options, an invalid option is reported here once instead of on every sort
+func NewSorter(opts Options) (*Sorter, error) {
+	if err := opts.compile(); err != nil {
+		return nil, err
+	}
+	return &Sorter{opts: opts}, nil
+}
+
+// PlanSort returns the order the declarations of src would be sorted in, without assembling the sorted source
+func PlanSort(src []byte, opts Options) (plan Plan, err error) {
+	if err = opts.compile(); err != nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			plan, err = Plan{}, fmt.Errorf("panic while planning: %v\n%s", r, stackSnippet(debug.Stack()))
+		}
+	}()
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ParseComments)
+	if err != nil {
+		return
+	}
+	for _, section := range getDeclSections(f, src, &opts) {
+		planSection := PlanSection{Kind: section.Kind, Names: make([]string, 0, len(section.List))}
+		for _, node := range section.List {
+			for _, decl := range append([]ast.Decl{node.Decl}, node.Group...) {
+				_, name := DeclKindName(decl)
+				planSection.Names = append(planSection.Names, name)
+			}
+		}
+		plan.Sections = append(plan.Sections, planSection)
+	}
+	return
+}
+
+// Sort returns the sorted src with the default options
+func Sort(src []byte) ([]byte, error) {
+	return SortWithOptions(src, Options{})
+}
+
+// SortWithOptions returns the sorted src with the options, use a Sorter to sort several sources with the same options
+func SortWithOptions(src []byte, opts Options) ([]byte, error) {
+	s, err := NewSorter(opts)
+	if err != nil {
+		return nil, err
+	}
+	return s.SortSource("", src)
+}
+
+// VerifyDecls checks that the sorted content has exactly the same declarations as the original,
+// declarations are compared by their printed form without comments, so positions don't matter,
+// the specs of a const or var block are compared one by one, as Options.SortWithinBlocks may reorder them,
+// so are the specs of an import block, that Options.GroupImports regroups,
+// the methods of an interface are compared regardless of their order, see Options.SortInterfaces,
+// the fields of a struct are compared in order, as reordering them changes the type identity
+func VerifyDecls(filename string, content, out []byte) (err error) {
+	count := make(map[string]int)
+	//order is the first appearance of every declaration, so the first difference of the source is reported
+	var order []string
+	for i, src := range [][]byte{content, out} {
+		fSet := token.NewFileSet()
+		f, e := parser.ParseFile(fSet, filename, src, parser.ParseComments)
+		if e != nil {
+			return e
+		}
+		for _, decl := range f.Decls {
+			nodes := []ast.Node{decl}
+			prefix := ""
+			if _decl, ok := decl.(*ast.GenDecl); ok && (_decl.Tok == token.IMPORT || _decl.Tok == token.CONST || _decl.Tok == token.VAR) && !isOrderSensitive(_decl) {
+				nodes = nodes[:0]
+				for _, spec := range _decl.Specs {
+					nodes = append(nodes, spec)
+				}
+				prefix = _decl.Tok.String() + " "
+			}
+			for _, node := range nodes {
+				var body bytes.Buffer
+				if _decl, ok := node.(*ast.GenDecl); ok && _decl.Tok == token.TYPE {
+					body, e = printTypeDecl(fSet, _decl)
+				} else {
+					e = printer.Fprint(&body, fSet, node)
+				}
+				if e != nil {
+					return e
+				}
+				key := prefix + body.String()
+				if _, ok := count[key]; !ok {
+					order = append(order, key)
+				}
+				if i == 0 {
+					count[key]++
+				} else {
+					count[key]--
+				}
+			}
+		}
+	}
+	for _, body := range order {
+		n := count[body]
+		if n == 0 {
+			continue
+		}
+		name, _, _ := strings.Cut(body, "\n")
+		if n > 0 {
+			return fmt.Errorf("declaration dropped by sort: %s", name)
+		}
+		return fmt.Errorf("declaration duplicated by sort: %s", name)
+	}
+	return
+}
+
+// getAnchorComments returns the floating comment groups containing the anchor text, in source order,
+// a file with a public marker has no anchors
+func getAnchorComments(f *ast.File, opts *Options) []*ast.CommentGroup {
+	if opts.Anchor == "" || getPublicMarker(f) != nil {
+		return nil
+	}
+	var anchors []*ast.CommentGroup
+	for _, commentGroup := range f.Comments {
+		if len(f.Decls) > 0 && commentGroup.End() > f.Decls[0].Pos() &&
+			!isDeclComment(f, commentGroup) &&
+			!isStatementComment(f, commentGroup) &&
+			strings.Contains(commentGroup.Text(), opts.Anchor) {
+			anchors = append(anchors, commentGroup)
+		}
+	}
+	return anchors
+}
+
+// getAssociatedFuncs returns the sorted functions associated with a type by the -associate-funcs patterns
+func getAssociatedFuncs(f *ast.File, name string, opts *Options) letterDeclList {
+	var list = make(letterDeclList, 0)
+	if len(opts.AssociateFuncs) == 0 {
+		return list
+	}
+	for _, decl := range f.Decls {
+		_decl, ok := decl.(*ast.FuncDecl)
+		if !ok || _decl.Recv != nil {
+			continue
+		}
+		if getAssociatedType(f, _decl.Name.Name, opts.AssociateFuncs) == name {
+			list = append(list, newLetterDecl(_decl.Name.Name, _decl, opts))
+		}
+	}
+	sort.Stable(list)
+	preserveSourceOrder(list, opts.PreserveOrderFor)
+	return list
+}
+
+// getAssociatedType returns the type of the file a declaration name is associated with, an empty string if none,
+// a pattern is a glob where {type} stands for the type name, e.g. New{type} or {type}From*,
+// the first matching pattern wins, then the longest type name, so ErrServer* prefers Server to Serve
+func getAssociatedType(f *ast.File, name string, patterns []string) string {
+	if len(patterns) == 0 || name == "main" || name == "init" {
+		return ""
+	}
+	for _, pattern := range patterns {
+		var match string
+		for _, decl := range f.Decls {
+			_decl, ok := decl.(*ast.GenDecl)
+			if !ok || _decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range _decl.Specs {
+				typeName := spec.(*ast.TypeSpec).Name.Name
+				if ok, _ := path.Match(strings.ReplaceAll(pattern, "{type}", typeName), name); ok && len(typeName) > len(match) {
+					match = typeName
+				}
+			}
+		}
+		if match != "" {
+			return match
+		}
+	}
+	return ""
+}
+
+// getAttachedComments returns the floating comment groups that must move with the declaration:
+// a floating //go:linkname directive is attached to the declaration of its local name,
+// a floating comment right above a const, var or type declaration, separated by at most one blank line,
+// is its label (e.g. "// Status codes") and is attached to it,
+// so is a floating group of //go: directives (e.g. //go:generate) right above any declaration,
+// a directive group followed by no declaration is a floating comment.
+func getAttachedComments(f *ast.File, content []byte, decl ast.Decl, kinds map[*ast.CommentGroup]commentKind) []*ast.CommentGroup {
+	var names []string
+	var start = decl.Pos()
+	var labeled = false
+	switch _decl := decl.(type) {
+	case *ast.FuncDecl:
+		if _decl.Recv == nil {
+			names = append(names, _decl.Name.Name)
+		}
+		if _decl.Doc != nil {
+			start = _decl.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if _decl.Tok == token.VAR {
+			for _, spec := range _decl.Specs {
+				for _, name := range spec.(*ast.ValueSpec).Names {
+					names = append(names, name.Name)
+				}
+			}
+		}
+		if _decl.Doc != nil {
+			start = _decl.Doc.Pos()
+		}
+		labeled = _decl.Tok != token.IMPORT
+	}
+	var list []*ast.CommentGroup
+	for _, commentGroup := range f.Comments {
+		if kind := kinds[commentGroup]; kind != floatingComment && kind != eofComment {
+			continue
+		}
+		if name := getLinknameLocal(commentGroup); name != "" {
+			if slices.Contains(names, name) {
+				list = append(list, commentGroup)
+			}
+			continue
+		}
+		if (labeled || isGoDirectiveComment(commentGroup)) && commentGroup.End() < start && isOwnLineComment(content, commentGroup) {
+			gap := content[commentGroup.End()-1 : start-1]
+			if len(bytes.TrimSpace(gap)) == 0 && bytes.Count(gap, []byte("\n")) <= 2 {
+				list = append(list, commentGroup)
+			}
+		}
+	}
+	return list
+}
+
+// getCommentKinds classifies every comment group of the file, the first matching category of the commentKind order wins
+func getCommentKinds(f *ast.File, content []byte, opts *Options) map[*ast.CommentGroup]commentKind {
+	kinds := make(map[*ast.CommentGroup]commentKind, len(f.Comments))
+	docs := make(map[*ast.CommentGroup]bool)
+	trailing := make(map[*ast.CommentGroup]bool)
+	for _, decl := range f.Decls {
+		switch _decl := decl.(type) {
+		case *ast.FuncDecl:
+			docs[_decl.Doc] = _decl.Doc != nil
+		case *ast.GenDecl:
+			docs[_decl.Doc] = _decl.Doc != nil
+		}
+		if commentGroup := getTrailingComment(f, content, decl); commentGroup != nil {
+			trailing[commentGroup] = true
+		}
+	}
+	anchors := getAnchorComments(f, opts)
+	for _, commentGroup := range f.Comments {
+		switch {
+		case commentGroup == f.Doc:
+			kinds[commentGroup] = packageDocComment
+		case isBeforePackageComment(f, content, commentGroup):
+			kinds[commentGroup] = beforePackageComment
+		case docs[commentGroup]:
+			kinds[commentGroup] = docComment
+		case isStatementComment(f, commentGroup):
+			kinds[commentGroup] = bodyComment
+		case trailing[commentGroup]:
+			kinds[commentGroup] = trailingComment
+		case isFileNolintComment(f, commentGroup):
+			kinds[commentGroup] = nolintComment
+		case isMarkerComment(f, commentGroup, PublicMarker) || isMarkerComment(f, commentGroup, SortedMarker):
+			kinds[commentGroup] = markerComment
+		case slices.Contains(anchors, commentGroup):
+			kinds[commentGroup] = anchorComment
+		case len(f.Decls) > 0 && commentGroup.Pos() > f.Decls[len(f.Decls)-1].End():
+			kinds[commentGroup] = eofComment
+		default:
+			kinds[commentGroup] = floatingComment
+		}
+	}
+	return kinds
+}
+
+// getDeclEnd returns the end of the declaration, a comment on the same line after it, e.g. "} // Foo", included
+func getDeclEnd(f *ast.File, content []byte, decl ast.Decl) token.Pos {
+	if commentGroup := getTrailingComment(f, content, decl); commentGroup != nil {
+		return commentGroup.End()
+	}
+	return decl.End()
+}
+
+// getDeclSections returns the sections of the sorted output in order, without the imports and the top comments:
+// main and init, then const, var, type (each type followed by its methods) and func,
+// with a public marker the four sections are repeated for unexported declarations below the marker,
+// with anchors they are repeated for the declarations between two anchors
+func getDeclSections(f *ast.File, content []byte, opts *Options) []declSection {
+	funcVars := getFuncVarNames(f)
+	decls := func(filter declFilter) []declSection {
+		vars := []declSection{{Kind: "var", List: getGenDeclList(f, content, token.VAR, filter, opts)}}
+		if opts.GroupFuncVars {
+			//function typed vars are a block of their own after the other vars
+			vars = []declSection{
+				{Kind: "var", List: getGenDeclList(f, content, token.VAR, func(name string, decl ast.Decl) bool {
+					return filter.match(name, decl) && !funcVars[name]
+				}, opts)},
+				{Kind: "var", List: getGenDeclList(f, content, token.VAR, func(name string, decl ast.Decl) bool {
+					return filter.match(name, decl) && funcVars[name]
+				}, opts)},
+			}
+		}
+		sections := []declSection{{Kind: "const", List: getGenDeclList(f, content, token.CONST, filter, opts)}}
+		sections = append(sections, vars...)
+		sections = append(sections,
+			declSection{Kind: "type", List: getGenDeclList(f, content, token.TYPE, filter, opts)},
+			declSection{Kind: "func", List: getFuncList(f, content, filter, opts)},
+		)
+		//a section that isn't enforced keeps the source order of its declarations,
+		//the methods written after their type belong to the type section
+		for _, section := range sections {
+			if len(opts.Enforce) > 0 && !slices.Contains(opts.Enforce, section.Kind) {
+				sort.SliceStable(section.List, func(i, j int) bool { return section.List[i].Decl.Pos() < section.List[j].Decl.Pos() })
+				for _, node := range section.List {
+					restoreMethodOrder(node.Group)
+				}
+			}
+		}
+		return sections
+	}
+	sections := []declSection{{Kind: "main", List: getMainList(f, opts)}}
+	if marker := getPublicMarker(f); marker != nil {
+		sections = append(sections, decls(func(name string, _ ast.Decl) bool { return ast.IsExported(name) })...)
+		sections = append(sections, declSection{Kind: "marker", Marker: marker})
+		return append(sections, decls(func(name string, _ ast.Decl) bool { return !ast.IsExported(name) })...)
+	}
+	//the declarations between two anchors are sorted among themselves
+	anchors := getAnchorComments(f, opts)
+	for i, anchor := range anchors {
+		sections = append(sections, decls(func(_ string, decl ast.Decl) bool {
+			return decl.Pos() < anchor.Pos() && (i == 0 || decl.Pos() > anchors[i-1].End())
+		})...)
+		sections = append(sections, declSection{Kind: "anchor", Marker: anchor})
+	}
+	if len(anchors) > 0 {
+		last := anchors[len(anchors)-1]
+		return append(sections, decls(func(_ string, decl ast.Decl) bool { return decl.Pos() > last.End() })...)
+	}
+	return append(sections, decls(nil)...)
+}
+
+// getDeclStart returns the start of the declaration, its doc included
+func getDeclStart(decl ast.Decl) token.Pos {
+	switch _decl := decl.(type) {
+	case *ast.GenDecl:
+		if _decl.Doc != nil {
+			return _decl.Doc.Pos()
+		}
+	case *ast.FuncDecl:
+		if _decl.Doc != nil {
+			return _decl.Doc.Pos()
+		}
+	}
+	return decl.Pos()
+}
+
+// getDirective returns the name of a directive comment, e.g. go:linkname or nolint, an empty string otherwise,
+// a directive is a line comment with its name right after the slashes, so text indented in an example,
+// e.g. "//	//go:build ignore", or inside a block comment is never mistaken for one
+func getDirective(comment *ast.Comment) string {
+	text, ok := strings.CutPrefix(comment.Text, "//")
+	if !ok || text == "" || text[0] == ' ' || text[0] == '\t' {
+		return ""
+	}
+	name := strings.Fields(text)[0]
+	//nolint lists the linters after a colon, e.g. nolint:errcheck,unused
+	if before, _, ok := strings.Cut(name, ":"); ok && before == "nolint" {
+		return before
+	}
+	return name
+}
+
+// getEnumClusters returns the String method of the types with a const block and the consts and vars it uses, in source order,
+// keyed by the first const block of their type, inCluster holds every declaration of a cluster
+func getEnumClusters(f *ast.File, content []byte, opts *Options) (clusters map[ast.Decl][]ast.Decl, inCluster map[ast.Decl]bool) {
+	clusters = make(map[ast.Decl][]ast.Decl)
+	inCluster = make(map[ast.Decl]bool)
+	if !opts.EnumCluster {
+		return
+	}
+	_, inRun := getValueRuns(f, content, opts.KeepValueRuns)
+	blocks := make(map[string]ast.Decl)
+	isBlock := make(map[ast.Decl]bool)
+	for _, decl := range f.Decls {
+		_decl, ok := decl.(*ast.GenDecl)
+		if !ok || _decl.Tok != token.CONST || inRun[_decl] {
+			continue
+		}
+		if len(_decl.Specs) == 0 {
+			continue
+		}
+		_type, ok := _decl.Specs[0].(*ast.ValueSpec).Type.(*ast.Ident)
+		if !ok {
+			continue
+		}
+		if _, ok := blocks[_type.Name]; !ok {
+			blocks[_type.Name] = _decl
+			isBlock[_decl] = true
+		}
+	}
+	for _, decl := range f.Decls {
+		method, ok := decl.(*ast.FuncDecl)
+		if !ok || method.Recv == nil || method.Name.Name != "String" || method.Body == nil {
+			continue
+		}
+		block, ok := blocks[getFuncReceiverTypeName(method)]
+		if !ok {
+			continue
+		}
+		used := make(map[string]bool)
+		ast.Inspect(method.Body, func(node ast.Node) bool {
+			if ident, ok := node.(*ast.Ident); ok {
+				used[ident.Name] = true
+			}
+			return true
+		})
+		group := []ast.Decl{method}
+		for _, decl := range f.Decls {
+			_decl, ok := decl.(*ast.GenDecl)
+			if !ok || (_decl.Tok != token.CONST && _decl.Tok != token.VAR) || isBlock[_decl] || inRun[_decl] ||
+				getErrorType(f, _decl, opts) != "" {
+				continue
+			}
+			for _, spec := range _decl.Specs {
+				if slices.ContainsFunc(spec.(*ast.ValueSpec).Names, func(name *ast.Ident) bool { return used[name.Name] }) {
+					group = append(group, _decl)
+					break
+				}
+			}
+		}
+		sort.Slice(group, func(i, j int) bool { return group[i].Pos() < group[j].Pos() })
+		clusters[block] = group
+		for _, decl := range group {
+			inCluster[decl] = true
+		}
+	}
+	return
+}
+
+// getErrorType returns the type an error sentinel var declaration is written with, an empty string if none,
+// with -errors-with-type every spec of the declaration must be an error, e.g. var ErrServerClosed = errors.New("..."),
+// and its first name must match an error pattern of a type of the file
+func getErrorType(f *ast.File, decl *ast.GenDecl, opts *Options) string {
+	if !opts.ErrorsWithType || decl.Tok != token.VAR || len(decl.Specs) == 0 {
+		return ""
+	}
+	for _, spec := range decl.Specs {
+		if !isErrorSpec(spec.(*ast.ValueSpec)) {
+			return ""
+		}
+	}
+	patterns := opts.ErrorPatterns
+	if len(patterns) == 0 {
+		patterns = []string{"Err{type}*", "err{type}*"}
+	}
+	return getAssociatedType(f, getGenDeclName(decl), patterns)
+}
+
+// getErrorVars returns the sorted error sentinel var declarations written with a type
+func getErrorVars(f *ast.File, name string, opts *Options) letterDeclList {
+	var list = make(letterDeclList, 0)
+	for _, decl := range f.Decls {
+		_decl, ok := decl.(*ast.GenDecl)
+		if !ok || _decl.Tok != token.VAR {
+			continue
+		}
+		if getErrorType(f, _decl, opts) == name {
+			list = append(list, newLetterDecl(getGenDeclName(_decl), _decl, opts))
+		}
+	}
+	sort.Stable(list)
+	preserveSourceOrder(list, opts.PreserveOrderFor)
+	return list
+}
+
+// getFieldName returns the name a struct field is sorted by, its first name, the type name of an embedded field,
+// e.g. Mutex for sync.Mutex or *sync.Mutex
+func getFieldName(field *ast.Field) string {
+	if len(field.Names) > 0 {
+		return field.Names[0].Name
+	}
+	_type := field.Type
+	if star, ok := _type.(*ast.StarExpr); ok {
+		_type = star.X
+	}
+	switch t := _type.(type) {
+	case *ast.IndexExpr:
+		_type = t.X
+	case *ast.IndexListExpr:
+		_type = t.X
+	}
+	switch t := _type.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	}
+	return ""
+}
+
+// getFileComments classifies the comment groups of the file and attaches the floating ones to their declarations, once per file
+func getFileComments(f *ast.File, content []byte, opts *Options) fileComments {
+	comments := fileComments{
+		Attached:   make(map[ast.Decl][]*ast.CommentGroup, len(f.Decls)),
+		IsAttached: make(map[*ast.CommentGroup]bool),
+		Kinds:      getCommentKinds(f, content, opts),
+	}
+	for _, decl := range f.Decls {
+		list := getAttachedComments(f, content, decl, comments.Kinds)
+		comments.Attached[decl] = list
+		for _, commentGroup := range list {
+			comments.IsAttached[commentGroup] = true
+		}
+	}
+	return comments
+}
+
+// getFuncList returns the sorted functions, without main, init and the methods of types declared in the file
+func getFuncList(f *ast.File, content []byte, filter declFilter, opts *Options) letterDeclList {
+	var list = make(letterDeclList, 0)
+	callers := getSoleCallers(f, opts)
+	_, inCluster := getEnumClusters(f, content, opts)
+	for _, decl := range f.Decls {
+		_decl, ok := decl.(*ast.FuncDecl)
+		if !ok || inCluster[_decl] {
+			continue
+		}
+		//if main or init, skip, a method named main or init is a regular method
+		if _decl.Recv == nil && (_decl.Name.Name == "main" || _decl.Name.Name == "init") {
+			continue
+		}
+		//if is a receiver function, and the receiver type is in the same file, skip
+		if _decl.Recv != nil {
+			if !opts.SeparateMethods && getTypeFromFile(f, getFuncReceiverTypeName(_decl)) != nil {
+				continue
+			}
+		} else if getAssociatedType(f, _decl.Name.Name, opts.AssociateFuncs) != "" {
+			//written after the methods of its type
+			continue
+		} else if _, ok := callers[_decl.Name.Name]; ok {
+			//written after its caller
+			continue
+		}
+		if !filter.match(_decl.Name.Name, _decl) {
+			continue
+		}
+		node := newLetterDecl(_decl.Name.Name, _decl, opts)
+		var helpers = make(letterDeclList, 0)
+		for _, helper := range f.Decls {
+			if helper, ok := helper.(*ast.FuncDecl); ok && helper.Recv == nil && callers[helper.Name.Name] == _decl {
+				helpers = append(helpers, newLetterDecl(helper.Name.Name, helper, opts))
+			}
+		}
+		sort.Stable(helpers)
+		for _, helper := range helpers {
+			node.Group = append(node.Group, helper.Decl)
+		}
+		list = append(list, node)
+	}
+	sort.Stable(list)
+	preserveSourceOrder(list, opts.PreserveOrderFor)
+	testedOrder(list, opts.tested)
+	if opts.GroupOrphanMethods {
+		//the methods of the types of other files follow the functions, grouped by their receiver type
+		var orphans = make(letterDeclList, 0)
+		for i := 0; i < len(list); i++ {
+			if list[i].Kind == "method" && getTypeFromFile(f, getFuncReceiverTypeName(list[i].Decl)) == nil {
+				orphans = append(orphans, list[i])
+				list = append(list[:i], list[i+1:]...)
+				i--
+			}
+		}
+		sort.SliceStable(orphans, func(i, j int) bool {
+			return getFuncReceiverTypeName(orphans[i].Decl) < getFuncReceiverTypeName(orphans[j].Decl)
+		})
+		list = append(list, orphans...)
+	}
+	return list
+}
+
+// getFuncReceiverTypeName returns the name of the receiver type of a method, without its type parameters,
+// an empty name for a function or a receiver it can't name
+func getFuncReceiverTypeName(decl ast.Decl) string {
+	fnDecl, ok := decl.(*ast.FuncDecl)
+	if !ok {
+		return ""
+	}
+	if fnDecl.Recv == nil || len(fnDecl.Recv.List) == 0 {
+		return ""
+	}
+	_type := fnDecl.Recv.List[0].Type
+	if __t, ok := _type.(*ast.StarExpr); ok {
+		_type = __t.X
+	}
+	//Generics type, with one or several type parameters
+	switch __t := _type.(type) {
+	case *ast.IndexExpr:
+		_type = __t.X
+	case *ast.IndexListExpr:
+		_type = __t.X
+	}
+	if ident, ok := _type.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// getFuncVarNames returns the names var declarations are sorted by, for the ones whose every spec is function typed,
+// by its type, e.g. var OnError func(error), or by its value, e.g. var OnError = func(error) {}
+func getFuncVarNames(f *ast.File) map[string]bool {
+	names := make(map[string]bool)
+	for _, decl := range f.Decls {
+		_decl, ok := decl.(*ast.GenDecl)
+		if !ok || _decl.Tok != token.VAR || len(_decl.Specs) == 0 {
+			continue
+		}
+		funcTyped := true
+		for _, spec := range _decl.Specs {
+			_spec := spec.(*ast.ValueSpec)
+			if _, ok := _spec.Type.(*ast.FuncType); ok {
+				continue
+			}
+			if len(_spec.Values) == 0 {
+				funcTyped = false
+				continue
+			}
+			for _, value := range _spec.Values {
+				if _, ok := value.(*ast.FuncLit); !ok {
+					funcTyped = false
+				}
+			}
+		}
+		if funcTyped {
+			names[getGenDeclName(_decl)] = true
+		}
+	}
+	return names
+}
+
+// getGenDeclList returns the sorted const, var or type declarations,
+// a type is grouped with the methods of all its specs
+func getGenDeclList(f *ast.File, content []byte, tk token.Token, filter declFilter, opts *Options) letterDeclList {
+	var list = make(letterDeclList, 0)
+	runs, inRun := getValueRuns(f, content, opts.KeepValueRuns)
+	clusters, inCluster := getEnumClusters(f, content, opts)
+	for _, decl := range f.Decls {
+		if _decl, ok := decl.(*ast.GenDecl); ok {
+			if inCluster[_decl] {
+				//written after its enum const block
+				continue
+			}
+			if inRun[_decl] {
+				//a mixed const and var run is written as a unit in the const section
+				if group, ok := runs[_decl]; ok && tk == token.CONST {
+					name := getGenDeclName(_decl)
+					if filter.match(name, _decl) {
+						node := newLetterDecl(name, _decl, opts)
+						node.Group = group
+						list = append(list, node)
+					}
+				}
+				continue
+			}
+			if _decl.Tok == tk && _decl.Tok != token.IMPORT && _decl.Tok != token.TYPE {
+				name := getGenDeclName(_decl)
+				//a block with sorted specs is placed by the spec written first
+				if order, _, _ := getSpecOrder(content, _decl, opts); order != nil {
+					name = _decl.Specs[order[0]].(*ast.ValueSpec).Names[0].Name
+				}
+				//an error sentinel of a type is written right after the type
+				if filter.match(name, _decl) && getErrorType(f, _decl, opts) == "" {
+					node := newLetterDecl(name, _decl, opts)
+					node.Group = clusters[_decl]
+					list = append(list, node)
+				}
+			}
+			if _decl.Tok == tk && _decl.Tok == token.TYPE {
+				name := getGenDeclName(_decl)
+				if filter.match(name, _decl) {
+					node := newLetterDecl(name, _decl, opts)
+					//get the group of types, their error sentinels and their receiver functions
+					for _, spec := range _decl.Specs {
+						for _, errVar := range getErrorVars(f, spec.(*ast.TypeSpec).Name.Name, opts) {
+							node.Group = append(node.Group, errVar.Decl)
+						}
+					}
+					for _, spec := range _decl.Specs {
+						if !opts.SeparateMethods {
+							for _, method := range getTypesReceiverFunc(f, spec.(*ast.TypeSpec).Name.Name, opts) {
+								if !inCluster[method.Decl] {
+									node.Group = append(node.Group, method.Decl)
+								}
+							}
+						}
+						for _, fn := range getAssociatedFuncs(f, spec.(*ast.TypeSpec).Name.Name, opts) {
+							node.Group = append(node.Group, fn.Decl)
+						}
+					}
+					list = append(list, node)
+				}
+			}
+		}
+	}
+	sort.Stable(list)
+	preserveSourceOrder(list, opts.PreserveOrderFor)
+	placeBlankDecls(list, opts.BlankDecls)
+	return list
+}
+
+// getGenDeclName returns the name a declaration is sorted by, the first name of its first spec,
+// an empty block, e.g. var (), has none and is sorted first
+func getGenDeclName(decl *ast.GenDecl) string {
+	if len(decl.Specs) == 0 {
+		return ""
+	}
+	switch spec := decl.Specs[0].(type) {
+	case *ast.ValueSpec:
+		if len(spec.Names) > 0 {
+			return spec.Names[0].Name
+		}
+	case *ast.TypeSpec:
+		return spec.Name.Name
+	}
+	return ""
+}
+
+// getInterfaceMethods returns the names of the methods an interface of the file declares, in their order,
+// nil if the interface isn't in the file, embedded interfaces are not followed
+func getInterfaceMethods(f *ast.File, name string) (methods []string) {
+	decl, ok := getTypeFromFile(f, name).(*ast.GenDecl)
+	if !ok {
+		return
+	}
+	for _, spec := range decl.Specs {
+		_spec := spec.(*ast.TypeSpec)
+		if _spec.Name.Name != name {
+			continue
+		}
+		_type, ok := _spec.Type.(*ast.InterfaceType)
+		if !ok || _type.Methods == nil {
+			return
+		}
+		for _, field := range _type.Methods.List {
+			if _, ok := field.Type.(*ast.FuncType); !ok {
+				continue
+			}
+			for _, ident := range field.Names {
+				methods = append(methods, ident.Name)
+			}
+		}
+	}
+	return
+}
+
+// getLeadingBlankLines returns the number of blank lines right above the declaration and its doc
+func getLeadingBlankLines(content []byte, decl ast.Decl) int {
+	start := getDeclStart(decl)
+	n := 0
+	end := bytes.LastIndexByte(content[:start-1], '\n')
+	for end > 0 {
+		lineStart := bytes.LastIndexByte(content[:end], '\n') + 1
+		if len(bytes.TrimSpace(content[lineStart:end])) > 0 {
+			break
+		}
+		n++
+		end = lineStart - 1
+	}
+	return n
+}
+
+// getLinknameLocal returns the local name of a comment group made only of //go:linkname directives
+// for the same local name, an empty string otherwise
+func getLinknameLocal(commentGroup *ast.CommentGroup) (name string) {
+	for _, comment := range commentGroup.List {
+		fields := strings.Fields(comment.Text)
+		if getDirective(comment) != "go:linkname" || len(fields) < 2 || (name != "" && fields[1] != name) {
+			return ""
+		}
+		name = fields[1]
+	}
+	return
+}
+
+// getMainList returns main and init functions in source order, with -main-first main comes before any init
+func getMainList(f *ast.File, opts *Options) letterDeclList {
+	var list = make(letterDeclList, 0)
+	for _, decl := range f.Decls {
+		_decl, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		// if has receiver, skip
+		if _decl.Recv != nil {
+			continue
+		}
+		if _decl.Name.Name == "main" || _decl.Name.Name == "init" {
+			list = append(list, letterDecl{Letter: _decl.Name.Name, Name: _decl.Name.Name, Kind: "func", Decl: _decl})
+		}
+	}
+	if opts.MainFirst {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Name == "main" && list[j].Name != "main" })
+	}
+	return list
+}
+
+// getMatchNames returns the names a declaration is matched by in patterns, a method is also matched as Type.Method,
+// a const or var block by every name it declares, e.g. a lookup table declared in a block
+func getMatchNames(name string, decl ast.Decl) []string {
+	names := []string{name}
+	switch _decl := decl.(type) {
+	case *ast.FuncDecl:
+		if _decl.Recv != nil {
+			names = append(names, getFuncReceiverTypeName(_decl)+"."+name)
+		}
+	case *ast.GenDecl:
+		if _decl.Tok == token.CONST || _decl.Tok == token.VAR {
+			for _, spec := range _decl.Specs {
+				for _, ident := range spec.(*ast.ValueSpec).Names {
+					if ident.Name != name {
+						names = append(names, ident.Name)
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// getPublicMarker returns the first public marker of the file, nil if there is none
+func getPublicMarker(f *ast.File) *ast.CommentGroup {
+	for _, commentGroup := range f.Comments {
+		if isMarkerComment(f, commentGroup, PublicMarker) {
+			return commentGroup
+		}
+	}
+	return nil
+}
+
+// getSoleCallers returns the unexported functions used by a single exported function and nowhere else in the file,
+// mapped to that function, with -helpers-after-callers they are written right after it.
+// A use is any reference to the name outside of the function itself, so a helper passed as a value is found too,
+// the selected names of selector expressions, e.g. a method or field with the same name, are not uses.
+func getSoleCallers(f *ast.File, opts *Options) map[string]*ast.FuncDecl {
+	callers := make(map[string]*ast.FuncDecl)
+	if !opts.HelpersAfterCallers {
+		return callers
+	}
+	helpers := make(map[string]bool)
+	for _, decl := range f.Decls {
+		_decl, ok := decl.(*ast.FuncDecl)
+		if ok && _decl.Recv == nil && !ast.IsExported(_decl.Name.Name) && _decl.Name.Name != "main" && _decl.Name.Name != "init" &&
+			getAssociatedType(f, _decl.Name.Name, opts.AssociateFuncs) == "" {
+			helpers[_decl.Name.Name] = true
+		}
+	}
+	users := make(map[string][]ast.Decl)
+	for _, decl := range f.Decls {
+		self := ""
+		if _decl, ok := decl.(*ast.FuncDecl); ok && _decl.Recv == nil {
+			self = _decl.Name.Name
+		}
+		var visit func(node ast.Node) bool
+		visit = func(node ast.Node) bool {
+			switch _node := node.(type) {
+			case *ast.SelectorExpr:
+				ast.Inspect(_node.X, visit)
+				return false
+			case *ast.Ident:
+				if helpers[_node.Name] && _node.Name != self && !slices.Contains(users[_node.Name], decl) {
+					users[_node.Name] = append(users[_node.Name], decl)
+				}
+			}
+			return true
+		}
+		ast.Inspect(decl, visit)
+	}
+	for name, list := range users {
+		caller, ok := list[0].(*ast.FuncDecl)
+		if len(list) == 1 && ok && caller.Recv == nil && ast.IsExported(caller.Name.Name) &&
+			getAssociatedType(f, caller.Name.Name, opts.AssociateFuncs) == "" {
+			callers[name] = caller
+		}
+	}
+	return callers
+}
+
+// getSpecOrder returns the order the specs of a const or var block are written in with Options.SortWithinBlocks,
+// and the ranges of the specs with their doc and line comments, order is nil when the block is kept as is
+func getSpecOrder(content []byte, decl *ast.GenDecl, opts *Options) (order, starts, ends []int) {
+	if !opts.SortWithinBlocks || (decl.Tok != token.CONST && decl.Tok != token.VAR) || len(decl.Specs) < 2 || isOrderSensitive(decl) {
+		return nil, nil, nil
+	}
+	starts = make([]int, len(decl.Specs))
+	ends = make([]int, len(decl.Specs))
+	nodes := make(letterDeclList, len(decl.Specs))
+	for i, spec := range decl.Specs {
+		_spec := spec.(*ast.ValueSpec)
+		starts[i], ends[i] = int(_spec.Pos())-1, int(_spec.End())-1
+		if _spec.Doc != nil {
+			starts[i] = int(_spec.Doc.Pos()) - 1
+		}
+		if _spec.Comment != nil {
+			ends[i] = int(_spec.Comment.End()) - 1
+		}
+		nodes[i] = newLetterDecl(_spec.Names[0].Name, decl, opts)
+	}
+	order = make([]int, len(decl.Specs))
+	for i := range order {
+		order[i] = i
+	}
+	//the specs are sorted run by run, the gap before a run holds a blank line or a floating comment
+	run := 0
+	for i := 1; i <= len(order); i++ {
+		if i < len(order) {
+			gap := content[ends[i-1]:starts[i]]
+			if len(bytes.Trim(gap, " \t\r\n;")) == 0 && bytes.Count(gap, []byte("\n")) < 2 {
+				continue
+			}
+		}
+		part := order[run:i]
+		sort.SliceStable(part, func(a, b int) bool {
+			return letterDeclList{nodes[part[a]], nodes[part[b]]}.Less(0, 1)
+		})
+		run = i
+	}
+	return
+}
+
+// getTrailingComment returns the comment group starting on the line the declaration ends, right after it, nil if none
+func getTrailingComment(f *ast.File, content []byte, decl ast.Decl) *ast.CommentGroup {
+	for _, commentGroup := range f.Comments {
+		if commentGroup.Pos() < decl.End() {
+			continue
+		}
+		if len(bytes.Trim(content[decl.End()-1:commentGroup.Pos()-1], " \t")) == 0 {
+			return commentGroup
+		}
+		break
+	}
+	return nil
+}
+
+func getTypeFromFile(f *ast.File, name string) ast.Decl {
+	for _, decl := range f.Decls {
+		_decl, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		if _decl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range _decl.Specs {
+			_type := spec.(*ast.TypeSpec)
+			if _type.Name.Name == name {
+				return _decl
+			}
+		}
+	}
+	return nil
+}
+
+// getTypesReceiverFunc returns the sorted methods of a type
+func getTypesReceiverFunc(f *ast.File, name string, opts *Options) letterDeclList {
+	var list = make(letterDeclList, 0)
+	for _, decl := range f.Decls {
+		_decl, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if _decl.Recv == nil {
+			continue
+		}
+		if getFuncReceiverTypeName(_decl) != name {
+			continue
+		}
+		list = append(list, newLetterDecl(_decl.Name.Name, _decl, opts))
+	}
+	sort.Stable(list)
+	if opts.MethodSort == "arity" {
+		arity := func(node letterDecl) int { return node.Decl.(*ast.FuncDecl).Type.Params.NumFields() }
+		sort.SliceStable(list, func(i, j int) bool { return arity(list[i]) < arity(list[j]) })
+	}
+	preserveSourceOrder(list, opts.PreserveOrderFor)
+	if opts.ImplMethodsFirst != "" {
+		implMethodsFirst(list, getInterfaceMethods(f, opts.ImplMethodsFirst))
+	}
+	return list
+}
+
+// getUnkeyedStructs returns the names of the types of the files used in an unkeyed composite literal, e.g. T{1, 2},
+// the type of an elided literal, e.g. the elements of []T{{1, 2}}, is the element type of the enclosing literal,
+// through the slice, array and map types declared in the files
+func getUnkeyedStructs(files ...*ast.File) []string {
+	types := make(map[string]ast.Expr)
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			if _decl, ok := decl.(*ast.GenDecl); ok && _decl.Tok == token.TYPE {
+				for _, spec := range _decl.Specs {
+					types[spec.(*ast.TypeSpec).Name.Name] = spec.(*ast.TypeSpec).Type
+				}
+			}
+		}
+	}
+	//getTypeName returns the name of a local type, through pointers and type arguments
+	getTypeName := func(_type ast.Expr) string {
+		if star, ok := _type.(*ast.StarExpr); ok {
+			_type = star.X
+		}
+		switch t := _type.(type) {
+		case *ast.IndexExpr:
+			_type = t.X
+		case *ast.IndexListExpr:
+			_type = t.X
+		}
+		if ident, ok := _type.(*ast.Ident); ok {
+			return ident.Name
+		}
+		return ""
+	}
+	var names []string
+	elided := make(map[*ast.CompositeLit]ast.Expr)
+	for _, f := range files {
+		ast.Inspect(f, func(node ast.Node) bool {
+			lit, ok := node.(*ast.CompositeLit)
+			if !ok {
+				return true
+			}
+			_type := lit.Type
+			if _type == nil {
+				_type = elided[lit]
+			}
+			name := getTypeName(_type)
+			if name != "" && len(lit.Elts) > 0 {
+				if _, ok := lit.Elts[0].(*ast.KeyValueExpr); !ok && !slices.Contains(names, name) {
+					names = append(names, name)
+				}
+			}
+			if underlying, ok := types[name]; ok {
+				_type = underlying
+			}
+			var key, elt ast.Expr
+			switch t := _type.(type) {
+			case *ast.ArrayType:
+				elt = t.Elt
+			case *ast.MapType:
+				key, elt = t.Key, t.Value
+			}
+			for _, expr := range lit.Elts {
+				if kv, ok := expr.(*ast.KeyValueExpr); ok {
+					if child, ok := kv.Key.(*ast.CompositeLit); ok && child.Type == nil {
+						elided[child] = key
+					}
+					expr = kv.Value
+				}
+				if child, ok := expr.(*ast.CompositeLit); ok && child.Type == nil {
+					elided[child] = elt
+				}
+			}
+			return true
+		})
+	}
+	return names
+}
+
+// getValueRuns returns the runs of adjacent const and var declarations that mix both kinds and start with a doc,
+// see isAdjacentDecl for adjacency,
+// runs maps the first declaration of a run to the following ones, inRun holds every declaration of a run
+func getValueRuns(f *ast.File, content []byte, keepValueRuns bool) (runs map[ast.Decl][]ast.Decl, inRun map[ast.Decl]bool) {
+	runs = make(map[ast.Decl][]ast.Decl)
+	inRun = make(map[ast.Decl]bool)
+	if !keepValueRuns {
+		return
+	}
+	isValue := func(decl ast.Decl) bool {
+		_decl, ok := decl.(*ast.GenDecl)
+		return ok && (_decl.Tok == token.CONST || _decl.Tok == token.VAR)
+	}
+	for i := 0; i < len(f.Decls); i++ {
+		head := f.Decls[i]
+		if !isValue(head) || head.(*ast.GenDecl).Doc == nil {
+			continue
+		}
+		mixed := false
+		j := i + 1
+		for ; j < len(f.Decls) && isValue(f.Decls[j]) &&
+			isAdjacentDecl(content, f.Decls[j-1].(*ast.GenDecl), f.Decls[j].(*ast.GenDecl)); j++ {
+			mixed = mixed || f.Decls[j].(*ast.GenDecl).Tok != head.(*ast.GenDecl).Tok
+		}
+		if !mixed {
+			continue
+		}
+		runs[head] = f.Decls[i+1 : j]
+		for _, decl := range f.Decls[i:j] {
+			inRun[decl] = true
+		}
+		i = j - 1
+	}
+	return
+}
+
+// groupImports returns the text of an import declaration, from posStart to posEnd, with its specs split into
+// the standard library, third-party and local groups sorted by path, every spec keeps its doc and line comment.
+// An import block is kept as is if it is not parenthesized, if a floating comment sits between its specs
+// or if it imports "C", the cgo preamble above the spec is C source that must stay byte for byte with it.
+func groupImports(content []byte, decl *ast.GenDecl, posStart, posEnd int, local string) []byte {
+	if !decl.Lparen.IsValid() || len(decl.Specs) == 0 {
+		return content[posStart:posEnd]
+	}
+	starts := make([]int, len(decl.Specs))
+	ends := make([]int, len(decl.Specs))
+	for i, spec := range decl.Specs {
+		_spec := spec.(*ast.ImportSpec)
+		if _spec.Path.Value == `"C"` {
+			return content[posStart:posEnd]
+		}
+		starts[i], ends[i] = int(_spec.Pos())-1, int(_spec.End())-1
+		if _spec.Doc != nil {
+			starts[i] = int(_spec.Doc.Pos()) - 1
+		}
+		if _spec.Comment != nil {
+			ends[i] = int(_spec.Comment.End()) - 1
+		}
+		if i > 0 && len(bytes.Trim(content[ends[i-1]:starts[i]], " \t\r\n;")) > 0 {
+			return content[posStart:posEnd]
+		}
+	}
+	var groups [3][]int
+	for i, spec := range decl.Specs {
+		group := importGroup(spec.(*ast.ImportSpec), local)
+		groups[group] = append(groups[group], i)
+	}
+	text := slices.Clone(content[posStart:decl.Lparen])
+	for _, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		//doc comments would not follow their spec if format.Source had to sort them
+		sort.SliceStable(group, func(i, j int) bool {
+			return decl.Specs[group[i]].(*ast.ImportSpec).Path.Value < decl.Specs[group[j]].(*ast.ImportSpec).Path.Value
+		})
+		text = append(text, '\n')
+		for _, i := range group {
+			text = append(text, '\t')
+			text = append(text, content[starts[i]:ends[i]]...)
+			text = append(text, '\n')
+		}
+	}
+	return append(text, content[decl.Rparen-1:posEnd]...)
+}
+
+// implMethodsFirst moves the methods of the interface first, in the order of the interface,
+// the list is left as is unless it has every method of the interface
+func implMethodsFirst(list letterDeclList, methods []string) {
+	if len(methods) == 0 {
+		return
+	}
+	index := make(map[string]int, len(methods))
+	for i, method := range methods {
+		index[method] = i
+	}
+	found := 0
+	for _, node := range list {
+		if _, ok := index[node.Name]; ok {
+			found++
+		}
+	}
+	if found != len(methods) {
+		return
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		at, inI := index[list[i].Name]
+		to, inJ := index[list[j].Name]
+		if inI && inJ {
+			return at < to
+		}
+		return inI && !inJ
+	})
+}
+
+// importGroup returns the group of an import with Options.GroupImports: 0 for the standard library,
+// whose first path element has no dot, 1 for third-party and 2 for the paths starting with the local prefix
+func importGroup(spec *ast.ImportSpec, local string) int {
+	importPath, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return 1
+	}
+	if local != "" && (importPath == local || strings.HasPrefix(importPath, strings.TrimSuffix(local, "/")+"/")) {
+		return 2
+	}
+	if first, _, _ := strings.Cut(importPath, "/"); !strings.Contains(first, ".") {
+		return 0
+	}
+	return 1
+}
+
+// isAdjacentDecl reports whether next starts on the line right after prev ends, with nothing in between,
+// a single blank line is allowed where gofmt always writes one, from a const to a var or above a doc,
+// a const following a var always ends a run, so a run written back stays the same run on the next sort
+func isAdjacentDecl(content []byte, prev, next *ast.GenDecl) bool {
+	if prev.Tok == token.VAR && next.Tok == token.CONST {
+		return false
+	}
+	gap := content[prev.End()-1 : getDeclStart(next)-1]
+	maxLines := 1
+	if prev.Tok != next.Tok || next.Doc != nil {
+		maxLines = 2
+	}
+	return bytes.Count(gap, []byte("\n")) <= maxLines && len(bytes.TrimSpace(gap)) == 0
+}
+
+// isAlreadySorted reports whether the declarations are already in sorted order and nothing else would move,
+// so the sorted content is the formatted content and the assembly can be skipped.
+// It only walks f.Decls and f.Comments: every comment must be a doc, in a body or before the package line,
+// the package clause must be followed by exactly one blank line and the declarations spaced like the assembly writes them.
+func isAlreadySorted(fSet *token.FileSet, f *ast.File, content []byte, opts *Options) bool {
+	if opts.Marker != "" || opts.StripWS || opts.SortInterfaces || opts.SortStructFields || opts.SortWithinBlocks || opts.GroupImports ||
+		opts.KeepBlankLines {
+		return false
+	}
+	for _, kind := range getCommentKinds(f, content, opts) {
+		if kind != packageDocComment && kind != beforePackageComment && kind != docComment && kind != bodyComment {
+			return false
+		}
+	}
+	//the declarations in the order the assembly writes them, the imports first, with their section,
+	//the declarations of a const or var section are written without blank lines between them
+	var decls []ast.Decl
+	var sections []int
+	for _, decl := range f.Decls {
+		if _decl, ok := decl.(*ast.GenDecl); ok && _decl.Tok == token.IMPORT {
+			decls, sections = append(decls, decl), append(sections, -1)
+		}
+	}
+	for i, section := range getDeclSections(f, content, opts) {
+		for _, node := range section.List {
+			for _, decl := range append([]ast.Decl{node.Decl}, node.Group...) {
+				if section.Kind != "const" && section.Kind != "var" {
+					decls, sections = append(decls, decl), append(sections, -1)
+				} else {
+					decls, sections = append(decls, decl), append(sections, i)
+				}
+			}
+		}
+	}
+	if !slices.Equal(decls, f.Decls) {
+		return false
+	}
+	if len(f.Decls) > 0 && fSet.Position(getDeclStart(f.Decls[0])).Line != fSet.Position(f.Package).Line+2 {
+		return false
+	}
+	//a sort separates the other declarations from their neighbors with one blank line, whatever the source spacing
+	for i := 1; i < len(decls); i++ {
+		gap := 2
+		if sections[i] >= 0 && sections[i] == sections[i-1] {
+			gap = 1
+		}
+		if fSet.Position(getDeclStart(decls[i])).Line != fSet.Position(decls[i-1].End()).Line+gap {
+			return false
+		}
+	}
+	return true
+}
+
+// isBeforePackageComment reports whether the comment group starts before the end of the package line,
+// these groups (license, build constraints, package doc, a comment on the package line) are copied by writePkg
+func isBeforePackageComment(f *ast.File, content []byte, commentGroup *ast.CommentGroup) bool {
+	lineEnd := bytes.IndexByte(content[f.Package-1:], '\n')
+	return lineEnd < 0 || commentGroup.Pos() < f.Package+token.Pos(lineEnd)
+}
+
+// isDeclComment reports whether the comment group is the doc of a declaration,
+// it relies on the doc attached by the parser, so stacked directives and CRLF line endings are recognized
+func isDeclComment(f *ast.File, commentGroup *ast.CommentGroup) bool {
+	for _, decl := range f.Decls {
+		var doc *ast.CommentGroup
+		switch _decl := decl.(type) {
+		case *ast.FuncDecl:
+			doc = _decl.Doc
+		case *ast.GenDecl:
+			doc = _decl.Doc
+		}
+		if doc == commentGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// isErrorSpec reports whether a var spec declares errors, by its error type or by errors.New or fmt.Errorf values
+func isErrorSpec(spec *ast.ValueSpec) bool {
+	if ident, ok := spec.Type.(*ast.Ident); ok && ident.Name == "error" {
+		return true
+	}
+	if len(spec.Values) == 0 {
+		return false
+	}
+	for _, value := range spec.Values {
+		call, ok := value.(*ast.CallExpr)
+		if !ok {
+			return false
+		}
+		fn, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return false
+		}
+		pkg, ok := fn.X.(*ast.Ident)
+		if !ok || !(pkg.Name == "errors" && fn.Sel.Name == "New" || pkg.Name == "fmt" && fn.Sel.Name == "Errorf") {
+			return false
+		}
+	}
+	return true
+}
+
+// isFileNolintComment reports whether the comment group is a floating //nolint directive above the first declaration,
+// it applies to the whole file so it keeps its place at the top
+func isFileNolintComment(f *ast.File, commentGroup *ast.CommentGroup) bool {
+	if getDirective(commentGroup.List[0]) != "nolint" || isDeclComment(f, commentGroup) {
+		return false
+	}
+	return len(f.Decls) == 0 || commentGroup.End() < f.Decls[0].Pos()
+}
+
+// isGoDirectiveComment reports whether the comment group is made only of //go: directives, e.g. //go:generate
+func isGoDirectiveComment(commentGroup *ast.CommentGroup) bool {
+	for _, comment := range commentGroup.List {
+		if !strings.HasPrefix(getDirective(comment), "go:") {
+			return false
+		}
+	}
+	return true
+}
+
+// isMarkerComment reports whether the comment group is a standalone comment with the marker text
+func isMarkerComment(f *ast.File, commentGroup *ast.CommentGroup, marker string) bool {
+	return len(commentGroup.List) == 1 &&
+		strings.TrimSpace(commentGroup.List[0].Text) == marker &&
+		!isDeclComment(f, commentGroup) &&
+		!isStatementComment(f, commentGroup)
+}
+
+// isMethodsOnlyInterface reports whether the interface only lists methods,
+// a constraint interface with embedded elements or type sets must keep its elements untouched
+func isMethodsOnlyInterface(_type *ast.InterfaceType) bool {
+	if _type.Methods == nil || len(_type.Methods.List) < 2 {
+		return false
+	}
+	for _, field := range _type.Methods.List {
+		if len(field.Names) != 1 {
+			return false
+		}
+		if _, ok := field.Type.(*ast.FuncType); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// isOrderSensitive reports whether moving the specs of a const block would change their values,
+// a spec using iota or repeating the expression of the previous one has a value that depends on its place
+func isOrderSensitive(decl *ast.GenDecl) bool {
+	if decl.Tok != token.CONST {
+		return false
+	}
+	for _, spec := range decl.Specs {
+		_spec := spec.(*ast.ValueSpec)
+		if len(_spec.Values) == 0 {
+			return true
+		}
+		for _, value := range _spec.Values {
+			usesIota := false
+			ast.Inspect(value, func(node ast.Node) bool {
+				if ident, ok := node.(*ast.Ident); ok && ident.Name == "iota" {
+					usesIota = true
+				}
+				return !usesIota
+			})
+			if usesIota {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isOwnLineComment reports whether the comment group starts its line, not trailing code on the same line
+func isOwnLineComment(content []byte, commentGroup *ast.CommentGroup) bool {
+	start := int(commentGroup.Pos()) - 1
+	lineStart := bytes.LastIndexByte(content[:start], '\n') + 1
+	return len(bytes.TrimSpace(content[lineStart:start])) == 0
+}
+
+// isSortableStruct reports whether the fields of the struct of a type spec can be sorted: it has several fields,
+// none of them blank, and the //go-sort:no-field-sort comment is neither in the doc of the declaration or the spec,
+// nor after the opening brace of the struct, nor after its closing brace, gofmt writes it // go-sort:no-field-sort in a doc
+func isSortableStruct(content []byte, decl *ast.GenDecl, spec *ast.TypeSpec, _type *ast.StructType) bool {
+	if _type.Fields == nil || len(_type.Fields.List) < 2 {
+		return false
+	}
+	isMarker := func(text string) bool {
+		return strings.TrimSpace(strings.TrimPrefix(text, "//")) == "go-sort:no-field-sort"
+	}
+	for _, commentGroup := range []*ast.CommentGroup{decl.Doc, spec.Doc, spec.Comment} {
+		if commentGroup != nil && slices.ContainsFunc(commentGroup.List, func(comment *ast.Comment) bool {
+			return isMarker(comment.Text)
+		}) {
+			return false
+		}
+	}
+	line := content[_type.Fields.Opening:]
+	if end := bytes.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+	if idx := bytes.Index(line, []byte("//")); idx >= 0 && isMarker(string(line[idx:])) {
+		return false
+	}
+	for _, field := range _type.Fields.List {
+		if getFieldName(field) == "_" {
+			return false
+		}
+	}
+	return true
+}
+
+// isStatementComment reports whether the comment group is inside a declaration, e.g. in a function body
+func isStatementComment(f *ast.File, commentGroup *ast.CommentGroup) bool {
+	for _, decl := range f.Decls {
+		if decl.Pos() < commentGroup.Pos() && commentGroup.End() < decl.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// lessStructField reports whether the struct field a is sorted before b, exported fields first, then by name
+func lessStructField(a, b *ast.Field) bool {
+	nameA, nameB := getFieldName(a), getFieldName(b)
+	if ast.IsExported(nameA) != ast.IsExported(nameB) {
+		return ast.IsExported(nameA)
+	}
+	return nameA < nameB
+}
+
+// matchPatterns returns the index of the first glob pattern matching one of the names, -1 if none matches
+func matchPatterns(patterns []string, names ...string) int {
+	for i, pattern := range patterns {
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// newLetterDecl returns the letterDecl of a declaration sorted by name
+func newLetterDecl(name string, decl ast.Decl, opts *Options) letterDecl {
+	kind, _ := DeclKindName(decl)
+	node := letterDecl{
+		Letter: sortKey(name, opts.StripPrefix, opts.StripSuffix),
+		Name:   name,
+		Kind:   kind,
+		Rank:   priorityRank(opts.Priority, getMatchNames(name, decl)...),
+		Decl:   decl,
+	}
+	if opts.collator != nil {
+		node.Key = opts.collator.key(node.Letter)
+	}
+	node.Fold = opts.CaseInsensitive
+	//exported names come first by their export tier, not because uppercase letters have the lowest bytes,
+	//so _name and names with other leading punctuation stay below them
+	if len(opts.ExportFirst) == 0 || slices.Contains(opts.ExportFirst, kind) {
+		if !ast.IsExported(name) {
+			node.Tier = 1
+		}
+	} else {
+		node.Fold = true
+	}
+	return node
+}
+
+// notifyDecl calls Options.OnDecl with a written declaration, if set
+func notifyDecl(decl ast.Decl, opts *Options) {
+	if opts.OnDecl == nil {
+		return
+	}
+	kind, name := DeclKindName(decl)
+	opts.OnDecl(DeclInfo{Kind: kind, Name: name})
+}
+
+// placeBlankDecls moves the declarations named _ to the bottom of the list or back to their index in the source order,
+// see Options.BlankDecls
+func placeBlankDecls(list letterDeclList, placement string) {
+	if placement == "" {
+		return
+	}
+	var blanks, rest letterDeclList
+	for _, node := range list {
+		if node.Name == "_" {
+			blanks = append(blanks, node)
+		} else {
+			rest = append(rest, node)
+		}
+	}
+	sort.SliceStable(blanks, func(i, j int) bool { return blanks[i].Decl.Pos() < blanks[j].Decl.Pos() })
+	switch placement {
+	case "bottom":
+		rest = append(rest, blanks...)
+	case "source":
+		source := slices.Clone(list)
+		sort.SliceStable(source, func(i, j int) bool { return source[i].Decl.Pos() < source[j].Decl.Pos() })
+		for i, node := range source {
+			if node.Name == "_" {
+				rest = slices.Insert(rest, i, node)
+			}
+		}
+	}
+	copy(list, rest)
+}
+
+// preserveSourceOrder puts the declarations matching the patterns back in their source order,
+// they keep the slots the sort gave them, so they still sort as a group against the other declarations
+func preserveSourceOrder(list letterDeclList, patterns []string) {
+	if len(patterns) == 0 {
+		return
+	}
+	var slots []int
+	var nodes []letterDecl
+	for i, node := range list {
+		if matchPatterns(patterns, getMatchNames(node.Name, node.Decl)...) >= 0 {
+			slots = append(slots, i)
+			nodes = append(nodes, node)
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].Decl.Pos() < nodes[j].Decl.Pos() })
+	for i, slot := range slots {
+		list[slot] = nodes[i]
+	}
+}
+
+// printTypeDecl prints a type declaration for VerifyDecls, the methods of its interfaces
+// are printed one by one after it, in the order of their printed form, struct fields stay in place
+func printTypeDecl(fSet *token.FileSet, decl *ast.GenDecl) (body bytes.Buffer, err error) {
+	var members []string
+	for _, spec := range decl.Specs {
+		_type, ok := spec.(*ast.TypeSpec).Type.(*ast.InterfaceType)
+		if !ok {
+			continue
+		}
+		list := _type.Methods
+		for _, field := range list.List {
+			var member bytes.Buffer
+			for _, name := range field.Names {
+				member.WriteString(name.Name + " ")
+			}
+			if err = printer.Fprint(&member, fSet, field.Type); err != nil {
+				return
+			}
+			members = append(members, member.String())
+		}
+		//the members are restored once the declaration is printed
+		defer func(fields []*ast.Field) { list.List = fields }(list.List)
+		list.List = nil
+	}
+	if err = printer.Fprint(&body, fSet, decl); err != nil {
+		return
+	}
+	sort.Strings(members)
+	for _, member := range members {
+		body.WriteString("\n" + member)
+	}
+	return
+}
+
+// priorityRank returns the index of the first priority pattern matching one of the names,
+// the number of patterns if none matches, a method is also matched as Type.Method
+func priorityRank(patterns []string, names ...string) int {
+	if i := matchPatterns(patterns, names...); i >= 0 {
+		return i
+	}
+	return len(patterns)
+}
+
+// restoreMethodOrder puts the methods of a group back in their source order, in the slots the sort gave them,
+// the other declarations of the group keep their place
+func restoreMethodOrder(group []ast.Decl) {
+	var slots []int
+	var methods []ast.Decl
+	for i, decl := range group {
+		if _decl, ok := decl.(*ast.FuncDecl); ok && _decl.Recv != nil {
+			slots = append(slots, i)
+			methods = append(methods, decl)
+		}
+	}
+	sort.SliceStable(methods, func(i, j int) bool { return methods[i].Pos() < methods[j].Pos() })
+	for i, slot := range slots {
+		group[slot] = methods[i]
+	}
+}
+
+// sortKey returns the key a declaration name is sorted by, without the prefixes and suffixes,
+// the first matching prefix and suffix are stripped, a name is never stripped to an empty key
+func sortKey(name string, prefixes, suffixes []string) string {
+	key := name
+	for _, prefix := range prefixes {
+		if prefix != "" && len(key) > len(prefix) && strings.HasPrefix(key, prefix) {
+			key = key[len(prefix):]
+			break
+		}
+	}
+	for _, suffix := range suffixes {
+		if suffix != "" && len(key) > len(suffix) && strings.HasSuffix(key, suffix) {
+			key = key[:len(key)-len(suffix)]
+			break
+		}
+	}
+	return key
+}
+
+// sortOnlyMethodsOf returns the content with only the methods of the type sorted,
+// the methods are sorted among the places they already take, every other byte stays where it is
+func sortOnlyMethodsOf(f *ast.File, content []byte, typeName string, opts *Options) []byte {
+	declRange := func(decl *ast.FuncDecl) (int, int) {
+		start := decl.Pos() - 1
+		if decl.Doc != nil {
+			start = decl.Doc.Pos() - 1
+		}
+		return int(start), int(getDeclEnd(f, content, decl) - 1)
+	}
+	var slots []*ast.FuncDecl
+	for _, decl := range f.Decls {
+		if _decl, ok := decl.(*ast.FuncDecl); ok && _decl.Recv != nil && getFuncReceiverTypeName(_decl) == typeName {
+			slots = append(slots, _decl)
+		}
+	}
+	sorted := getTypesReceiverFunc(f, typeName, opts)
+	slot := 0
+	for _, decl := range f.Decls {
+		if slot < len(slots) && decl == ast.Decl(slots[slot]) {
+			decl = sorted[slot].Decl
+			slot++
+		}
+		notifyDecl(decl, opts)
+	}
+	var out = make([]byte, 0, len(content))
+	var last = 0
+	for i, slot := range slots {
+		start, _ := declRange(slot)
+		out = append(out, content[last:start]...)
+		start, end := declRange(sorted[i].Decl.(*ast.FuncDecl))
+		out = append(out, content[start:end]...)
+		_, last = declRange(slot)
+	}
+	return append(out, content[last:]...)
+}
+
+// sortTypeMembers returns the text of a type declaration, from posStart to posEnd, with the methods of its
+// interfaces sorted by name with Options.SortInterfaces and the fields of its structs with Options.SortStructFields,
+// every member keeps its doc, tag and line comment.
+// An interface is kept as is if it has embedded elements or type sets (e.g. ~int | ~string),
+// a struct if it has a blank field, e.g. padding, or the //go-sort:no-field-sort directive in its doc or line comment,
+// and both if a floating comment sits between their members.
+func sortTypeMembers(content []byte, decl *ast.GenDecl, posStart, posEnd int, opts *Options) []byte {
+	var text []byte
+	var last = posStart
+	for _, spec := range decl.Specs {
+		_spec := spec.(*ast.TypeSpec)
+		var fields []*ast.Field
+		var less func(a, b *ast.Field) bool
+		switch _type := _spec.Type.(type) {
+		case *ast.InterfaceType:
+			if !opts.SortInterfaces || !isMethodsOnlyInterface(_type) {
+				continue
+			}
+			fields = _type.Methods.List
+			less = func(a, b *ast.Field) bool { return a.Names[0].Name < b.Names[0].Name }
+		case *ast.StructType:
+			if !opts.SortStructFields || !isSortableStruct(content, decl, _spec, _type) || slices.Contains(opts.unkeyed, _spec.Name.Name) {
+				continue
+			}
+			fields = _type.Fields.List
+			less = lessStructField
+		default:
+			continue
+		}
+		starts := make([]int, len(fields))
+		ends := make([]int, len(fields))
+		for i, field := range fields {
+			starts[i], ends[i] = int(field.Pos())-1, int(field.End())-1
+			if field.Doc != nil {
+				starts[i] = int(field.Doc.Pos()) - 1
+			}
+			if field.Comment != nil {
+				ends[i] = int(field.Comment.End()) - 1
+			}
+		}
+		floating := false
+		for i := 1; i < len(fields); i++ {
+			if len(bytes.Trim(content[ends[i-1]:starts[i]], " \t\r\n;")) > 0 {
+				floating = true
+			}
+		}
+		if floating {
+			continue
+		}
+		order := make([]int, len(fields))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool { return less(fields[order[i]], fields[order[j]]) })
+		for i, idx := range order {
+			text = append(text, content[last:starts[i]]...)
+			text = append(text, content[starts[idx]:ends[idx]]...)
+			last = ends[i]
+		}
+	}
+	return append(text, content[last:posEnd]...)
+}
+
+// stackSnippet returns the top frames of a stack trace, from the frame that panicked
+func stackSnippet(stack []byte) string {
+	lines := strings.Split(string(stack), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "panic(") {
+			lines = lines[i:]
+			break
+		}
+	}
+	if len(lines) > 12 {
+		lines = lines[:12]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// stripTrailingWhitespace trims trailing spaces and tabs of every line,
+// lines ending inside a raw string literal are kept as is since the whitespace is part of the value
+func stripTrailingWhitespace(src []byte) []byte {
+	type span struct{ start, end int }
+	var rawStrings []span
+	var s scanner.Scanner
+	file := token.NewFileSet().AddFile("", -1, len(src))
+	s.Init(file, src, nil, scanner.ScanComments)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.STRING && strings.HasPrefix(lit, "`") {
+			start := file.Offset(pos)
+			rawStrings = append(rawStrings, span{start, start + len(lit)})
+		}
+	}
+	inRawString := func(offset int) bool {
+		for _, r := range rawStrings {
+			if r.start < offset && offset < r.end {
+				return true
+			}
+		}
+		return false
+	}
+	var out = make([]byte, 0, len(src))
+	var offset = 0
+	for _, line := range bytes.SplitAfter(src, []byte("\n")) {
+		offset += len(line)
+		body, hasNewline := bytes.CutSuffix(line, []byte("\n"))
+		if !inRawString(offset - 1) {
+			body = bytes.TrimRight(body, " \t")
+		}
+		out = append(out, body...)
+		if hasNewline {
+			out = append(out, '\n')
+		}
+	}
+	return out
+}
+
+// testedOrder puts the test functions matching a tested declaration in the order of the tested declarations,
+// they keep the slots the sort gave them, a test matches the longest tested name it is named after
+func testedOrder(list letterDeclList, tested []string) {
+	if len(tested) == 0 {
+		return
+	}
+	var slots []int
+	var nodes []letterDecl
+	var index = make(map[ast.Decl]int)
+	for i, node := range list {
+		if node.Kind != "func" {
+			continue
+		}
+		var rest string
+		for _, prefix := range []string{"Test", "Benchmark", "Fuzz", "Example"} {
+			if after, ok := strings.CutPrefix(node.Name, prefix); ok {
+				rest = strings.TrimPrefix(after, "_")
+				break
+			}
+		}
+		match := -1
+		for j, name := range tested {
+			if (rest == name || strings.HasPrefix(rest, name+"_")) && (match < 0 || len(name) > len(tested[match])) {
+				match = j
+			}
+		}
+		if rest != "" && match >= 0 {
+			slots = append(slots, i)
+			nodes = append(nodes, node)
+			index[node.Decl] = match
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return index[nodes[i].Decl] < index[nodes[j].Decl] })
+	for i, slot := range slots {
+		list[slot] = nodes[i]
+	}
+}
+
+// warnBelowPublicMarker warns about the exported declarations found below the public marker, they are moved above it
+func warnBelowPublicMarker(fSet *token.FileSet, f *ast.File, marker *ast.CommentGroup, warnf func(format string, args ...any)) {
+	for _, decl := range f.Decls {
+		if decl.Pos() < marker.End() {
+			continue
+		}
+		var name string
+		switch _decl := decl.(type) {
+		case *ast.FuncDecl:
+			if _decl.Recv != nil || _decl.Name.Name == "main" || _decl.Name.Name == "init" {
+				continue
+			}
+			name = _decl.Name.Name
+		case *ast.GenDecl:
+			if _decl.Tok == token.IMPORT {
+				continue
+			}
+			_, name = DeclKindName(_decl)
+		}
+		if ast.IsExported(name) {
+			warnf("%s: exported %s below %q, moved above it\n", fSet.Position(decl.Pos()), name, PublicMarker)
+		}
+	}
+}
+
+// warnEmptyDecls warns about the empty const, var and type blocks, e.g. var (), they have no name and are sorted first,
+// SortSource only calls it when the output differs from the content
+func warnEmptyDecls(fSet *token.FileSet, f *ast.File, warnf func(format string, args ...any)) {
+	for _, decl := range f.Decls {
+		if _decl, ok := decl.(*ast.GenDecl); ok && _decl.Tok != token.IMPORT && len(_decl.Specs) == 0 {
+			warnf("%s: empty %s declaration is sorted first in its section", fSet.Position(_decl.Pos()), _decl.Tok)
+		}
+	}
+}
+
+// warnUnkeyedStructs warns about the unsorted structs of the file whose fields are kept in order, as an unkeyed composite literal uses them
+func warnUnkeyedStructs(fSet *token.FileSet, f *ast.File, content []byte, unkeyed []string, warnf func(format string, args ...any)) {
+	for _, decl := range f.Decls {
+		_decl, ok := decl.(*ast.GenDecl)
+		if !ok || _decl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range _decl.Specs {
+			_spec := spec.(*ast.TypeSpec)
+			if _type, ok := _spec.Type.(*ast.StructType); ok && isSortableStruct(content, _decl, _spec, _type) && slices.Contains(unkeyed, _spec.Name.Name) &&
+				!sort.SliceIsSorted(_type.Fields.List, func(i, j int) bool { return lessStructField(_type.Fields.List[i], _type.Fields.List[j]) }) {
+				warnf("%s: fields of struct %s are not sorted, it is used in an unkeyed composite literal", fSet.Position(_spec.Pos()), _spec.Name.Name)
+			}
+		}
+	}
+}
+
+func write2buf(buf *bytes.Buffer, fSet *token.FileSet, f *ast.File, content []byte, opts *Options) (err error) {
+	comments := getFileComments(f, content, opts)
+	write2bufTop(buf, f, content, comments, opts)
+	write2bufTopComment(buf, f, content, comments)
+	if marker := getPublicMarker(f); marker != nil && opts.Warnf != nil {
+		warnBelowPublicMarker(fSet, f, marker, opts.Warnf)
+	}
+	for _, section := range getDeclSections(f, content, opts) {
+		write2bufSection(buf, f, content, comments, section, opts)
+	}
+	write2bufBottomComment(buf, f, content, comments)
+	ret, err := format.Source(buf.Bytes())
+	if err != nil {
+		return
+	}
+	buf.Reset()
+	buf.Write(ret)
+	return
+}
+
+// write2bufAsDecl write a declaration with its doc, the range ends exactly at the end of the declaration,
+// so a multi-line value, e.g. a func literal, is kept intact even at the end of the file,
+// a parenthesized block is copied verbatim, the blank lines separating its sub-groups included
+func write2bufAsDecl(buf *bytes.Buffer, f *ast.File, content []byte, comments fileComments, decl ast.Decl, writeLine bool, opts *Options) {
+	_decl := decl.(*ast.GenDecl)
+	notifyDecl(_decl, opts)
+	write2bufAttachedComments(buf, content, comments, _decl)
+	posStart := _decl.Pos() - 1
+	if _decl.Doc != nil {
+		posStart = _decl.Doc.Pos() - 1
+	}
+	end := getDeclEnd(f, content, _decl) - 1
+	text := content[posStart:end]
+	if _decl.Tok == token.TYPE && (opts.SortInterfaces || opts.SortStructFields) {
+		text = sortTypeMembers(content, _decl, int(posStart), int(end), opts)
+	}
+	if _decl.Tok == token.IMPORT && opts.GroupImports {
+		text = groupImports(content, _decl, int(posStart), int(end), opts.LocalPrefix)
+	}
+	if order, starts, ends := getSpecOrder(content, _decl, opts); order != nil {
+		text = nil
+		last := int(posStart)
+		for i, idx := range order {
+			text = append(text, content[last:starts[i]]...)
+			text = append(text, content[starts[idx]:ends[idx]]...)
+			last = ends[i]
+		}
+		text = append(text, content[last:end]...)
+	}
+	buf.Write(text)
+	buf.WriteString("\n")
+	if writeLine {
+		buf.WriteString("\n")
+	}
+}
+
+func write2bufAsFunc(buf *bytes.Buffer, f *ast.File, content []byte, comments fileComments, decl ast.Decl, writeLine bool, opts *Options) {
+	_decl := decl.(*ast.FuncDecl)
+	notifyDecl(_decl, opts)
+	write2bufAttachedComments(buf, content, comments, _decl)
+	posStart := _decl.Pos() - 1
+	if _decl.Doc != nil {
+		posStart = _decl.Doc.Pos() - 1
+	}
+	buf.Write(content[posStart : getDeclEnd(f, content, _decl)-1])
+	buf.WriteString("\n")
+	if writeLine {
+		buf.WriteString("\n")
+	}
+}
+
+// write2bufAttachedComments write the floating comments that travel with a declaration, in source order
+func write2bufAttachedComments(buf *bytes.Buffer, content []byte, comments fileComments, decl ast.Decl) {
+	for _, commentGroup := range comments.Attached[decl] {
+		buf.Write(content[commentGroup.Pos()-1 : commentGroup.End()-1])
+		buf.WriteString("\n\n")
+	}
+}
+
+// write2bufBottomComment write the comments found after the last declaration, in source order
+func write2bufBottomComment(buf *bytes.Buffer, f *ast.File, content []byte, comments fileComments) {
+	for _, commentGroup := range f.Comments {
+		if comments.Kinds[commentGroup] == eofComment && !comments.IsAttached[commentGroup] {
+			buf.Write(content[commentGroup.Pos()-1 : commentGroup.End()-1])
+			buf.WriteString("\n\n")
+		}
+	}
+}
+
+// write2bufNode write a declaration and the declarations grouped with it,
+// with Options.KeepBlankLines each one is preceded by its blank lines in the source, unless it starts the section
+func write2bufNode(buf *bytes.Buffer, f *ast.File, content []byte, comments fileComments, node letterDecl, first, writeLine bool, opts *Options) {
+	for i, decl := range append([]ast.Decl{node.Decl}, node.Group...) {
+		if opts.KeepBlankLines && (!first || i > 0) {
+			buf.Write(bytes.Repeat([]byte("\n"), getLeadingBlankLines(content, decl)))
+		}
+		switch decl.(type) {
+		case *ast.GenDecl:
+			write2bufAsDecl(buf, f, content, comments, decl, writeLine, opts)
+		case *ast.FuncDecl:
+			write2bufAsFunc(buf, f, content, comments, decl, writeLine, opts)
+		}
+	}
+}
+
+// write2bufSection write a section, const and var declarations are written without blank lines between them
+func write2bufSection(buf *bytes.Buffer, f *ast.File, content []byte, comments fileComments, section declSection, opts *Options) {
+	if section.Marker != nil {
+		buf.Write(content[section.Marker.Pos()-1 : section.Marker.End()-1])
+		buf.WriteString("\n\n")
+		return
+	}
+	writeLine := section.Kind != "const" && section.Kind != "var" && !opts.KeepBlankLines
+	for i, node := range section.List {
+		write2bufNode(buf, f, content, comments, node, i == 0, writeLine, opts)
+	}
+	//an empty section writes nothing, so a file without funcs or values gets no stray blank lines
+	if !writeLine && len(section.List) > 0 {
+		buf.WriteString("\n")
+	}
+}
+
+func write2bufTop(buf *bytes.Buffer, f *ast.File, content []byte, comments fileComments, opts *Options) {
+	list := make(letterDeclList, 0)
+	for _, decl := range f.Decls {
+		if _decl, ok := decl.(*ast.GenDecl); ok {
+			if _decl.Tok == token.IMPORT {
+				list = append(list, letterDecl{Letter: "import", Decl: _decl})
+			}
+		}
+	}
+	for _, decl := range list {
+		write2bufAsDecl(buf, f, content, comments, decl.Decl, true, opts)
+	}
+}
+
+func write2bufTopComment(buf *bytes.Buffer, f *ast.File, content []byte, comments fileComments) {
+	for _, commentGroup := range f.Comments {
+		if comments.Kinds[commentGroup] == floatingComment && !comments.IsAttached[commentGroup] {
+			buf.Write(content[commentGroup.Pos()-1 : commentGroup.End()])
+			buf.WriteString("\n")
+		}
+	}
+}
+
+func writePkg(buf *bytes.Buffer, fSet *token.FileSet, f *ast.File, content []byte) {
+	line := fSet.Position(f.Package).Line
+	var bufTop = make([]byte, 0)
+	var idx = 0
+	for i := 0; i < line; i++ {
+		c := bytes.IndexByte(content[idx:], '\n')
+		if c == -1 {
+			//the package line is the last line
+			idx = len(content)
+			break
+		}
+		idx += c + 1
+	}
+	//declarations on the package line, e.g. "package a; var b = 1", are written by the sections
+	if len(f.Decls) > 0 && fSet.Position(f.Decls[0].Pos()).Line == line {
+		bufTop = append(bufTop, content[:f.Name.End()-1]...)
+		bufTop = append(bufTop, '\n')
+		idx = len(bufTop)
+	} else {
+		bufTop = append(bufTop, content[:idx]...)
+	}
+	//exactly one blank line separates the package clause from the first declaration
+	if idx == len(content) && !bytes.HasSuffix(bufTop, []byte("\n")) {
+		bufTop = append(bufTop, '\n')
+	}
+	bufTop = append(bufTop, '\n')
+	//a file level //nolint directive below the package clause stays right below it
+	for _, commentGroup := range f.Comments {
+		if isFileNolintComment(f, commentGroup) && !isBeforePackageComment(f, content, commentGroup) {
+			bufTop = append(bufTop, content[commentGroup.Pos()-1:commentGroup.End()-1]...)
+			bufTop = append(bufTop, "\n\n"...)
+		}
+	}
+	buf.Write(bufTop)
+}
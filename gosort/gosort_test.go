@@ -0,0 +1,1599 @@
+package gosort
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// sortCases are the sorts of a source by every option, src is written as want
+var sortCases = []struct {
+	name string
+	opts Options
+	src  string
+	want string
+}{
+	{
+		name: "default",
+		opts: Options{},
+		src: `package a
+
+func b() {}
+
+type T struct{}
+
+var v = 1
+
+const c = 1
+
+func a() {}
+
+func (T) m() {}
+`,
+		want: `package a
+
+const c = 1
+
+var v = 1
+
+type T struct{}
+
+func (T) m() {}
+
+func a() {}
+
+func b() {}
+`,
+	},
+	{
+		name: "anchor",
+		opts: Options{Anchor: "--- handlers ---"},
+		src: `package a
+
+func d() {}
+
+func c() {}
+
+// --- handlers ---
+
+func b() {}
+
+func a() {}
+`,
+		want: `package a
+
+func c() {}
+
+func d() {}
+
+// --- handlers ---
+
+func a() {}
+
+func b() {}
+`,
+	},
+	{
+		name: "associate funcs",
+		opts: Options{AssociateFuncs: []string{"New{type}"}},
+		src: `package a
+
+func NewServer() *Server { return nil }
+
+func Other() {}
+
+type Server struct{}
+
+func (s *Server) Run() {}
+`,
+		want: `package a
+
+type Server struct{}
+
+func (s *Server) Run() {}
+
+func NewServer() *Server { return nil }
+
+func Other() {}
+`,
+	},
+	{
+		name: "blank decls bottom",
+		opts: Options{BlankDecls: "bottom"},
+		src: `package a
+
+var _ I = (*T)(nil)
+
+var b = 1
+
+var a = 2
+
+type I interface{}
+
+type T struct{}
+`,
+		want: `package a
+
+var a = 2
+var b = 1
+var _ I = (*T)(nil)
+
+type I interface{}
+
+type T struct{}
+`,
+	},
+	{
+		name: "blank decls source",
+		opts: Options{BlankDecls: "source"},
+		src: `package a
+
+var b = 1
+
+var _ I = (*T)(nil)
+
+var a = 2
+
+type I interface{}
+
+type T struct{}
+`,
+		want: `package a
+
+var a = 2
+var _ I = (*T)(nil)
+var b = 1
+
+type I interface{}
+
+type T struct{}
+`,
+	},
+	{
+		name: "build constraints",
+		opts: Options{},
+		src: `// Copyright 2026 The Authors
+
+//go:build linux && !race
+// +build linux,!race
+
+// Package a is only built on linux
+package a
+
+func b() {}
+
+// a is first
+func a() {}
+`,
+		want: `// Copyright 2026 The Authors
+
+//go:build linux && !race
+// +build linux,!race
+
+// Package a is only built on linux
+package a
+
+// a is first
+func a() {}
+
+func b() {}
+`,
+	},
+	{
+		name: "case insensitive",
+		opts: Options{CaseInsensitive: true},
+		src: `package a
+
+func banana() {}
+
+func Apple() {}
+
+func apple() {}
+
+func Cherry() {}
+`,
+		want: `package a
+
+func Apple() {}
+
+func Cherry() {}
+
+func apple() {}
+
+func banana() {}
+`,
+	},
+	{
+		name: "cgo preamble",
+		opts: Options{},
+		src: `package a
+
+/*
+#cgo CFLAGS: -O2
+#include <stdio.h>
+#include   "a.h"
+
+static int add(int a,  int b) {
+    return a+b;
+}
+*/
+import "C"
+
+import "fmt"
+
+func b() { fmt.Println(C.add(1, 2)) }
+
+func a() {}
+`,
+		want: `package a
+
+/*
+#cgo CFLAGS: -O2
+#include <stdio.h>
+#include   "a.h"
+
+static int add(int a,  int b) {
+    return a+b;
+}
+*/
+import "C"
+
+import "fmt"
+
+func a() {}
+
+func b() { fmt.Println(C.add(1, 2)) }
+`,
+	},
+	{
+		name: "collate",
+		opts: Options{Collate: "fr"},
+		src: `package a
+
+func zèbre() {}
+
+func éclair() {}
+
+func eau() {}
+`,
+		want: `package a
+
+func eau() {}
+
+func éclair() {}
+
+func zèbre() {}
+`,
+	},
+	{
+		name: "enum cluster",
+		opts: Options{EnumCluster: true},
+		src: `package a
+
+func (c Color) String() string { return colorNames[c] }
+
+var colorNames = map[Color]string{Red: "red", Blue: "blue"}
+
+type Color int
+
+const (
+	Red Color = iota
+	Blue
+)
+
+var a = 1
+`,
+		want: `package a
+
+const (
+	Red Color = iota
+	Blue
+)
+
+func (c Color) String() string { return colorNames[c] }
+
+var colorNames = map[Color]string{Red: "red", Blue: "blue"}
+
+var a = 1
+
+type Color int
+`,
+	},
+	{
+		name: "enforce",
+		opts: Options{Enforce: []string{"func"}},
+		src: `package a
+
+type B struct{}
+
+type A struct{}
+
+func d() {}
+
+func c() {}
+`,
+		want: `package a
+
+type B struct{}
+
+type A struct{}
+
+func c() {}
+
+func d() {}
+`,
+	},
+	{
+		name: "errors with type",
+		opts: Options{ErrorsWithType: true},
+		src: `package a
+
+import "errors"
+
+var ErrServerDown = errors.New("down")
+
+var a = 1
+
+type Server struct{}
+
+type Client struct{}
+`,
+		want: `package a
+
+import "errors"
+
+var a = 1
+
+type Client struct{}
+
+type Server struct{}
+
+var ErrServerDown = errors.New("down")
+`,
+	},
+	{
+		name: "error patterns",
+		opts: Options{ErrorsWithType: true, ErrorPatterns: []string{"{type}Error*"}},
+		src: `package a
+
+import "errors"
+
+var ServerErrorDown = errors.New("down")
+
+var ErrServer = errors.New("server")
+
+type Server struct{}
+`,
+		want: `package a
+
+import "errors"
+
+var ErrServer = errors.New("server")
+
+type Server struct{}
+
+var ServerErrorDown = errors.New("down")
+`,
+	},
+	{
+		name: "export first",
+		opts: Options{ExportFirst: []string{"type"}},
+		src: `package a
+
+func b() {}
+
+func B() {}
+
+func a() {}
+
+type b2 struct{}
+
+type A2 struct{}
+`,
+		want: `package a
+
+type A2 struct{}
+
+type b2 struct{}
+
+func a() {}
+
+func B() {}
+
+func b() {}
+`,
+	},
+	{
+		name: "generic receivers",
+		opts: Options{},
+		src: `package a
+
+func (p *Pair[K, V]) Value() V { return p.v }
+
+type Pair[K comparable, V any] struct {
+	k K
+	v V
+}
+
+func (p Pair[_, _]) Len() int { return 2 }
+
+func (p *Pair[K, V]) Key() K { return p.k }
+
+type List[T any] []T
+
+func (l List[T]) Len() int { return len(l) }
+
+func Map[T, U any](l List[T], f func(T) U) List[U] { return nil }
+`,
+		want: `package a
+
+type List[T any] []T
+
+func (l List[T]) Len() int { return len(l) }
+
+type Pair[K comparable, V any] struct {
+	k K
+	v V
+}
+
+func (p *Pair[K, V]) Key() K { return p.k }
+
+func (p Pair[_, _]) Len() int { return 2 }
+
+func (p *Pair[K, V]) Value() V { return p.v }
+
+func Map[T, U any](l List[T], f func(T) U) List[U] { return nil }
+`,
+	},
+	{
+		name: "go generate",
+		opts: Options{},
+		src: `package a
+
+//go:generate go run gen.go -top
+
+import "fmt"
+
+//go:generate stringer -type=Color
+
+func b() { fmt.Println() }
+
+//go:generate go run gen.go
+type Color int
+
+func a() {}
+
+//go:generate go run gen.go -bottom
+`,
+		want: `package a
+
+//go:generate go run gen.go -top
+
+import "fmt"
+
+//go:generate go run gen.go
+type Color int
+
+func a() {}
+
+//go:generate stringer -type=Color
+
+func b() { fmt.Println() }
+
+//go:generate go run gen.go -bottom
+`,
+	},
+	{
+		name: "group func vars",
+		opts: Options{GroupFuncVars: true},
+		src: `package a
+
+var b = func() {}
+
+var z = 1
+
+var a = func() {}
+
+var y = 2
+`,
+		want: `package a
+
+var y = 2
+var z = 1
+
+var a = func() {}
+var b = func() {}
+`,
+	},
+	{
+		name: "group imports",
+		opts: Options{GroupImports: true, LocalPrefix: "example.com/m"},
+		src: `package a
+
+import (
+	"example.com/m/x"
+	"github.com/a/b"
+	"fmt"
+)
+
+var _ = fmt.Sprint(x.A, b.B)
+`,
+		want: `package a
+
+import (
+	"fmt"
+
+	"github.com/a/b"
+
+	"example.com/m/x"
+)
+
+var _ = fmt.Sprint(x.A, b.B)
+`,
+	},
+	{
+		name: "group orphan methods",
+		opts: Options{GroupOrphanMethods: true},
+		src: `package a
+
+func (o *Other) b() {}
+
+func z() {}
+
+func (o *Other) a() {}
+
+func y() {}
+`,
+		want: `package a
+
+func y() {}
+
+func z() {}
+
+func (o *Other) a() {}
+
+func (o *Other) b() {}
+`,
+	},
+	{
+		name: "helpers after callers",
+		opts: Options{HelpersAfterCallers: true},
+		src: `package a
+
+func helper() {}
+
+func Zed() { helper() }
+
+func Alpha() {}
+`,
+		want: `package a
+
+func Alpha() {}
+
+func Zed() { helper() }
+
+func helper() {}
+`,
+	},
+	{
+		name: "impl methods first",
+		opts: Options{ImplMethodsFirst: "Runner"},
+		src: `package a
+
+type Runner interface {
+	Stop()
+	Start()
+}
+
+type T struct{}
+
+func (T) a() {}
+
+func (T) Start() {}
+
+func (T) Stop() {}
+`,
+		want: `package a
+
+type Runner interface {
+	Stop()
+	Start()
+}
+
+type T struct{}
+
+func (T) Stop() {}
+
+func (T) Start() {}
+
+func (T) a() {}
+`,
+	},
+	{
+		name: "imports in several declarations",
+		opts: Options{},
+		src: `package a
+
+// #include <stdlib.h>
+import "C"
+
+import (
+	"os"
+	"fmt"
+)
+
+// strings is on its own
+import "strings"
+
+func b() { C.free(nil) }
+
+func a() { fmt.Println(os.Args, strings.ToUpper("a")) }
+`,
+		want: `package a
+
+// #include <stdlib.h>
+import "C"
+
+import (
+	"fmt"
+	"os"
+)
+
+// strings is on its own
+import "strings"
+
+func a() { fmt.Println(os.Args, strings.ToUpper("a")) }
+
+func b() { C.free(nil) }
+`,
+	},
+	{
+		name: "keep blank lines",
+		opts: Options{KeepBlankLines: true},
+		src: `package a
+
+const b = 1
+
+const a = 2
+const c = 3
+`,
+		want: `package a
+
+const a = 2
+
+const b = 1
+const c = 3
+`,
+	},
+	{
+		name: "keep value runs",
+		opts: Options{KeepValueRuns: true},
+		src: `package a
+
+var z = 1
+
+// run
+const y = 1
+var x = 2
+
+const a = 3
+`,
+		want: `package a
+
+const a = 3
+
+// run
+const y = 1
+
+var x = 2
+
+var z = 1
+`,
+	},
+	{
+		name: "keep value runs end at a blank line",
+		opts: Options{KeepValueRuns: true},
+		src: `package a
+
+// doc
+const b = 1
+
+const a = 2
+var c = 3
+`,
+		want: `package a
+
+const a = 2
+
+// doc
+const b = 1
+
+var c = 3
+`,
+	},
+	{
+		name: "keep value runs end at a const after a var",
+		opts: Options{KeepValueRuns: true},
+		src: `package a
+
+var z = 1
+
+// doc
+var y = 1
+const x = 2
+`,
+		want: `package a
+
+const x = 2
+
+// doc
+var y = 1
+var z = 1
+`,
+	},
+	{
+		name: "keep value runs of documented values",
+		opts: Options{KeepValueRuns: true},
+		src: `package a
+
+var z = 1
+
+// run
+const y = 1
+// doc
+const x = 2
+var w = 3
+
+const a = 3
+`,
+		want: `package a
+
+const a = 3
+
+// run
+const y = 1
+
+// doc
+const x = 2
+
+var w = 3
+
+var z = 1
+`,
+	},
+	{
+		name: "linkname",
+		opts: Options{},
+		src: `package a
+
+import _ "unsafe"
+
+//go:linkname b runtime.b
+
+func nothing() {}
+
+func c() {}
+
+func b()
+`,
+		want: `package a
+
+import _ "unsafe"
+
+//go:linkname b runtime.b
+
+func b()
+
+func c() {}
+
+func nothing() {}
+`,
+	},
+	{
+		name: "main first",
+		opts: Options{MainFirst: true},
+		src: `package main
+
+func init() {}
+
+func b() {}
+
+func main() {}
+`,
+		want: `package main
+
+func main() {}
+
+func init() {}
+
+func b() {}
+`,
+	},
+	{
+		name: "marker top",
+		opts: Options{Marker: "top"},
+		src: `package a
+
+func b() {}
+
+func a() {}
+`,
+		want: `package a
+
+// sorted by go-sort
+
+func a() {}
+
+func b() {}
+`,
+	},
+	{
+		name: "marker bottom",
+		opts: Options{Marker: "bottom"},
+		src: `package a
+
+func b() {}
+
+func a() {}
+`,
+		want: `package a
+
+func a() {}
+
+func b() {}
+
+// sorted by go-sort
+`,
+	},
+	{
+		name: "method sort arity",
+		opts: Options{MethodSort: "arity"},
+		src: `package a
+
+type T struct{}
+
+func (T) a(x, y int) {}
+
+func (T) c() {}
+
+func (T) b(x int) {}
+`,
+		want: `package a
+
+type T struct{}
+
+func (T) c() {}
+
+func (T) b(x int) {}
+
+func (T) a(x, y int) {}
+`,
+	},
+	{
+		name: "nolint",
+		opts: Options{},
+		src: `//nolint:all
+package a
+
+func c() {}
+
+//nolint:gocyclo // b is long
+func b() {}
+
+func a() {} //nolint:unused
+`,
+		want: `//nolint:all
+package a
+
+func a() {} //nolint:unused
+
+//nolint:gocyclo // b is long
+func b() {}
+
+func c() {}
+`,
+	},
+	{
+		name: "only methods of",
+		opts: Options{OnlyMethodsOf: "T"},
+		src: `package a
+
+func b() {}
+
+func a() {}
+
+type T struct{}
+
+func (T) d() {}
+
+func (T) c() {}
+`,
+		want: `package a
+
+func b() {}
+
+func a() {}
+
+type T struct{}
+
+func (T) c() {}
+
+func (T) d() {}
+`,
+	},
+	{
+		name: "pragmas",
+		opts: Options{},
+		src: `package a
+
+func c() {}
+
+// b is the hot path
+//
+//go:noinline
+//go:nosplit
+func b() {}
+
+//go:norace
+//go:nocheckptr
+func a() {}
+`,
+		want: `package a
+
+//go:norace
+//go:nocheckptr
+func a() {}
+
+// b is the hot path
+//
+//go:noinline
+//go:nosplit
+func b() {}
+
+func c() {}
+`,
+	},
+	{
+		name: "preserve order for",
+		opts: Options{PreserveOrderFor: []string{"z*"}},
+		src: `package a
+
+func zb() {}
+
+func a() {}
+
+func za() {}
+`,
+		want: `package a
+
+func a() {}
+
+func zb() {}
+
+func za() {}
+`,
+	},
+	{
+		name: "priority",
+		opts: Options{Priority: []string{"registry"}},
+		src: `package a
+
+var b = 1
+
+var registry = map[string]int{}
+
+var a = 2
+`,
+		want: `package a
+
+var registry = map[string]int{}
+var a = 2
+var b = 1
+`,
+	},
+	{
+		name: "semicolons",
+		opts: Options{},
+		src: `package a
+
+var b = 2; var a = 1
+
+func d() {}; func c() {}
+
+type f int; type e int
+`,
+		want: `package a
+
+var a = 1
+var b = 2
+
+type e int
+
+type f int
+
+func c() {}
+
+func d() {}
+`,
+	},
+	{
+		name: "separate methods",
+		opts: Options{SeparateMethods: true},
+		src: `package a
+
+type T struct{}
+
+func (T) b() {}
+
+func a() {}
+
+func c() {}
+`,
+		want: `package a
+
+type T struct{}
+
+func a() {}
+
+func (T) b() {}
+
+func c() {}
+`,
+	},
+	{
+		name: "sort within blocks",
+		opts: Options{SortWithinBlocks: true},
+		src: `package a
+
+var (
+	b = 1
+	a = 2
+
+	d = 3
+	c = 4
+)
+`,
+		want: `package a
+
+var (
+	a = 2
+	b = 1
+
+	c = 4
+	d = 3
+)
+`,
+	},
+	{
+		name: "sort interfaces",
+		opts: Options{SortInterfaces: true},
+		src: `package a
+
+type I interface {
+	// Stop stops
+	Stop()
+	Start()
+}
+`,
+		want: `package a
+
+type I interface {
+	Start()
+	// Stop stops
+	Stop()
+}
+`,
+	},
+	{
+		name: "sort interfaces with type sets",
+		opts: Options{SortInterfaces: true},
+		src: `package a
+
+type Number interface {
+	~int | ~int64 | ~float64
+	String() string
+	Abs() Number
+}
+
+type Formatter interface {
+	String() string
+	Format(verb rune) string
+}
+
+type Ordered interface {
+	Number
+	~string
+	Less(Ordered) bool
+	Cmp(Ordered) int
+}
+`,
+		want: `package a
+
+type Formatter interface {
+	Format(verb rune) string
+	String() string
+}
+
+type Number interface {
+	~int | ~int64 | ~float64
+	String() string
+	Abs() Number
+}
+
+type Ordered interface {
+	Number
+	~string
+	Less(Ordered) bool
+	Cmp(Ordered) int
+}
+`,
+	},
+	{
+		name: "sort struct fields",
+		opts: Options{SortStructFields: true},
+		src:  "package a\n\ntype T struct {\n\tb int\n\t// A is exported\n\tA string `json:\"a\"`\n\tsync.Mutex\n}\n\ntype U struct { //go-sort:no-field-sort\n\tb int\n\ta int\n}\n\ntype P struct {\n\ty int\n\tx int\n}\n\nvar p = P{1, 2}\n",
+		want: "package a\n\nvar p = P{1, 2}\n\ntype P struct {\n\ty int\n\tx int\n}\n\ntype T struct {\n\t// A is exported\n\tA string `json:\"a\"`\n\tsync.Mutex\n\tb int\n}\n\ntype U struct { //go-sort:no-field-sort\n\tb int\n\ta int\n}\n",
+	},
+	{
+		name: "strip prefix",
+		opts: Options{StripPrefix: []string{"Must"}},
+		src: `package a
+
+func MustC() {}
+
+func B() {}
+
+func A() {}
+`,
+		want: `package a
+
+func A() {}
+
+func B() {}
+
+func MustC() {}
+`,
+	},
+	{
+		name: "strip suffix",
+		opts: Options{StripSuffix: []string{"Handler"}},
+		src: `package a
+
+func BHandler() {}
+
+func C() {}
+
+func A() {}
+`,
+		want: `package a
+
+func A() {}
+
+func BHandler() {}
+
+func C() {}
+`,
+	},
+	{
+		name: "strip ws",
+		opts: Options{StripWS: true},
+		src:  "package a\n\nvar b = `x   \ny`\n\nvar a = 1\n",
+		want: "package a\n\nvar a = 1\nvar b = `x   \ny`\n",
+	},
+	{
+		name: "trailing comments",
+		opts: Options{},
+		src: `package a
+
+func b() {}
+
+func a() {}
+
+/*
+the end of the file
+*/
+
+// TODO: more
+`,
+		want: `package a
+
+func a() {}
+
+func b() {}
+
+/*
+the end of the file
+*/
+
+// TODO: more
+`,
+	},
+}
+
+func TestPlanSort(t *testing.T) {
+	src := "package a\n\nfunc b() {}\n\ntype T struct{}\n\nfunc (T) m() {}\n\nconst (\n\tx = 1\n\ty = 2\n)\n\nfunc main() {}\n"
+	plan, err := PlanSort([]byte(src), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, section := range plan.Sections {
+		got = append(got, section.Kind+":"+strings.Join(section.Names, " "))
+	}
+	want := "main:main|const:x,y|var:|type:T T.m|func:b"
+	if strings.Join(got, "|") != want {
+		t.Errorf("got %s, want %s", strings.Join(got, "|"), want)
+	}
+}
+
+func TestForModule(t *testing.T) {
+	src := "package a\n\nimport (\n\t\"example.com/m/x\"\n\t\"fmt\"\n\t\"github.com/a/b\"\n)\n\nvar _ = fmt.Sprint(x.A, b.B)\n"
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			name: "module imports are local",
+			opts: Options{GroupImports: true},
+			want: "package a\n\nimport (\n\t\"fmt\"\n\n\t\"github.com/a/b\"\n\n\t\"example.com/m/x\"\n)\n\nvar _ = fmt.Sprint(x.A, b.B)\n",
+		},
+		{
+			name: "local prefix wins",
+			opts: Options{GroupImports: true, LocalPrefix: "github.com/a"},
+			want: "package a\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/m/x\"\n\n\t\"github.com/a/b\"\n)\n\nvar _ = fmt.Sprint(x.A, b.B)\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _ := NewSorter(tc.opts)
+			got, err := s.ForModule("example.com/m").SortSource("a.go", []byte(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestForPackage(t *testing.T) {
+	s, _ := NewSorter(Options{SortStructFields: true})
+	s, err := s.ForPackage(map[string][]byte{"b.go": []byte("package a\n\nvar p = &P{1, 2}\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := "package a\n\ntype P struct {\n\ty int\n\tx int\n}\n\ntype Q struct {\n\tb int\n\ta int\n}\n"
+	got, err := s.SortSource("a.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "package a\n\ntype P struct {\n\ty int\n\tx int\n}\n\ntype Q struct {\n\ta int\n\tb int\n}\n"
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if _, err = s.ForPackage(map[string][]byte{"broken.go": []byte("package")}); err == nil || !strings.HasPrefix(err.Error(), "broken.go:") {
+		t.Errorf("got %v, want an error in broken.go", err)
+	}
+}
+
+func TestForTest(t *testing.T) {
+	s, _ := NewSorter(Options{})
+	//the tested source is sorted as Alpha, Zed, T, T.M
+	tested := "package a\n\ntype T struct{}\n\nfunc (T) M() {}\n\nfunc Zed() {}\n\nfunc Alpha() {}\n"
+	s, err := s.ForTest([]byte(tested))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := "package a\n\nimport \"testing\"\n\nfunc TestZed(t *testing.T) {}\n\nfunc TestT_M(t *testing.T) {}\n\n" +
+		"func TestAlpha(t *testing.T) {}\n\nfunc TestT(t *testing.T) {}\n"
+	got, err := s.SortSource("a_test.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "package a\n\nimport \"testing\"\n\nfunc TestT(t *testing.T) {}\n\nfunc TestT_M(t *testing.T) {}\n\n" +
+		"func TestAlpha(t *testing.T) {}\n\nfunc TestZed(t *testing.T) {}\n"
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestIsAlreadySorted(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  string
+		want bool
+	}{
+		{name: "sorted", src: "package a\n\nconst a = 1\nconst b = 2\n\nvar c = 1\n\nfunc d() {}\n", want: true},
+		{name: "blank line between consts", src: "package a\n\nconst a = 1\n\nconst b = 2\n"},
+		{name: "no blank line between funcs", src: "package a\n\nfunc a() {}\nfunc b() {}\n"},
+		{name: "reordered", src: "package a\n\nfunc b() {}\n\nfunc a() {}\n"},
+		{name: "floating comment", src: "package a\n\n// note\n\nfunc a() {}\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fSet := token.NewFileSet()
+			f, err := parser.ParseFile(fSet, "a.go", tc.src, parser.ParseComments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ast.SortImports(fSet, f)
+			opts := &Options{}
+			if got := isAlreadySorted(fSet, f, []byte(tc.src), opts); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+			var buf bytes.Buffer
+			writePkg(&buf, fSet, f, []byte(tc.src))
+			if err = write2buf(&buf, fSet, f, []byte(tc.src), opts); err != nil {
+				t.Fatal(err)
+			}
+			formatted, _ := format.Source([]byte(tc.src))
+			if tc.want && !bytes.Equal(buf.Bytes(), formatted) {
+				t.Errorf("the assembly writes:\n%s\nwant the formatted source:\n%s", buf.Bytes(), formatted)
+			}
+		})
+	}
+}
+
+func TestNewSorterErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{name: "marker", opts: Options{Marker: "side"}, want: "unknown marker location: side"},
+		{name: "enforce", opts: Options{Enforce: []string{"method"}}, want: "unknown section to enforce: method"},
+		{name: "blank decls", opts: Options{BlankDecls: "top"}, want: "unknown blank declarations placement: top"},
+		{name: "method sort", opts: Options{MethodSort: "size"}, want: "unknown method sort: size"},
+		{name: "collate", opts: Options{Collate: "not a locale"}, want: "unknown collate locale not a locale"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewSorter(tc.opts)
+			if err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+				t.Errorf("got %v, want %s", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestOnDecl(t *testing.T) {
+	var names []string
+	opts := Options{OnDecl: func(info DeclInfo) { names = append(names, info.Kind+" "+info.Name) }}
+	src := "package a\n\nfunc b() {}\n\ntype T struct{}\n\nfunc (T) m() {}\n\nvar v = 1\n"
+	if _, err := SortWithOptions([]byte(src), opts); err != nil {
+		t.Fatal(err)
+	}
+	want := "var v,type T,method T.m,func b"
+	if got := strings.Join(names, ","); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestOutOfOrder(t *testing.T) {
+	s, _ := NewSorter(Options{})
+	src := "package a\n\nfunc a() {}\n\nfunc c() {}\n\nfunc b() {}\n\nfunc d() {}\n"
+	for _, tc := range []struct {
+		name  string
+		lines [2]int
+		want  []string
+	}{
+		{name: "touched", lines: [2]int{7, 7}, want: []string{"7:1 b c"}},
+		{name: "untouched", lines: [2]int{3, 3}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			disorders, err := s.OutOfOrder("a.go", []byte(src), func(start, end int) bool {
+				return start <= tc.lines[1] && end >= tc.lines[0]
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, disorder := range disorders {
+				got = append(got, fmt.Sprintf("%d:%d %s %s", disorder.Position.Line, disorder.Position.Column, disorder.Name, disorder.Neighbor))
+			}
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func BenchmarkSort(b *testing.B) {
+	//the same declarations in reverse, the sorted source takes the isAlreadySorted fast path
+	var buf bytes.Buffer
+	buf.WriteString("package a\n")
+	for i := 200; i > 0; i-- {
+		fmt.Fprintf(&buf, "\n// T%03d is a type\ntype T%03d struct{ n int }\n\nfunc (t T%03d) N() int { return t.n }\n", i, i, i)
+	}
+	unsorted := buf.Bytes()
+	sorted, err := Sort(unsorted)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bc := range []struct {
+		name string
+		src  []byte
+	}{
+		{name: "sorted", src: sorted},
+		{name: "unsorted", src: unsorted},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(bc.src)))
+			for i := 0; i < b.N; i++ {
+				if _, err := Sort(bc.src); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSortSourceContent(t *testing.T) {
+	//the file on disk differs from the content, a second read of it would show in the output
+	filename := filepath.Join(t.TempDir(), "a.go")
+	if err := os.WriteFile(filename, []byte("package b\n\nfunc d() {}\n\nfunc c() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range sortCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := NewSorter(tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.SortSource(filename, []byte(tc.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSortSourceParseError(t *testing.T) {
+	s, _ := NewSorter(Options{})
+	_, err := s.SortSource("broken.go", []byte("package a\nfunc {\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "broken.go:2:6") {
+		t.Errorf("got %v, want an error at broken.go:2:6", err)
+	}
+}
+
+func TestSortWithOptions(t *testing.T) {
+	for _, tc := range sortCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := SortWithOptions([]byte(tc.src), tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+			//reordered fields make another type, VerifyDecls reports them
+			if err = VerifyDecls("", []byte(tc.src), got); (err != nil) != tc.opts.SortStructFields {
+				t.Errorf("VerifyDecls: %v", err)
+			}
+		})
+	}
+}
+
+func TestSortWithOptionsTwice(t *testing.T) {
+	for _, tc := range sortCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := SortWithOptions([]byte(tc.want), tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSorterConcurrent(t *testing.T) {
+	//every sorter is shared by several goroutines, run with -race to catch a shared mutable state
+	var wg sync.WaitGroup
+	for _, tc := range sortCases {
+		s, err := NewSorter(tc.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		for n := 0; n < 8; n++ {
+			wg.Add(2)
+			go func(name, src, want string) {
+				defer wg.Done()
+				got, _, err := s.Sort([]byte(src))
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+				} else if string(got) != want {
+					t.Errorf("%s: got\n%s\nwant\n%s", name, got, want)
+				}
+			}(tc.name, tc.src, tc.want)
+			go func(name string) {
+				defer wg.Done()
+				if _, _, err := s.Sort([]byte("package a\nfunc {\n")); err == nil {
+					t.Errorf("%s: no error for a broken source", name)
+				}
+			}(tc.name)
+		}
+	}
+	wg.Wait()
+}
+
+func TestVerifyDecls(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  string
+		out  string
+		ok   bool
+	}{
+		{name: "reordered", src: "package a\n\nfunc b() {}\n\nfunc a() {}\n", out: "package a\n\nfunc a() {}\n\nfunc b() {}\n", ok: true},
+		{name: "lost", src: "package a\n\nfunc b() {}\n\nfunc a() {}\n", out: "package a\n\nfunc a() {}\n"},
+		{name: "changed", src: "package a\n\nfunc b() {}\n\nfunc a() {}\n", out: "package a\n\nfunc a() {}\n\nfunc b() { panic(1) }\n"},
+		{name: "interface methods reordered", src: "package a\n\ntype I interface {\n\tb()\n\ta()\n}\n", out: "package a\n\ntype I interface {\n\ta()\n\tb()\n}\n", ok: true},
+		{name: "struct fields reordered", src: "package a\n\ntype T struct {\n\tb int\n\ta int\n}\n", out: "package a\n\ntype T struct {\n\ta int\n\tb int\n}\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := VerifyDecls("a.go", []byte(tc.src), []byte(tc.out)); (err == nil) != tc.ok {
+				t.Errorf("got %v, want ok %v", err, tc.ok)
+			}
+		})
+	}
+}
+
+func TestWarnf(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+		src  string
+		want string
+	}{
+		{
+			name: "empty declaration",
+			src:  "package a\n\nvar b = 1\n\nvar ()\n",
+			want: "5:1: empty var declaration is sorted first in its section",
+		},
+		{
+			name: "empty declaration of a sorted file",
+			src:  "package a\n\nvar ()\nvar b = 1\n",
+		},
+		{
+			name: "below public marker",
+			src:  "package a\n\nfunc a() {}\n\n// gosort:public\n\nfunc B() {}\n",
+			want: `7:1: exported B below "// gosort:public", moved above it`,
+		},
+		{
+			name: "unkeyed struct",
+			opts: Options{SortStructFields: true},
+			src:  "package a\n\ntype P struct {\n\ty int\n\tx int\n}\n\nvar p = []P{{1, 2}}\n",
+			want: "3:6: fields of struct P are not sorted, it is used in an unkeyed composite literal",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var warnings []string
+			tc.opts.Warnf = func(format string, args ...any) {
+				warnings = append(warnings, strings.TrimSpace(fmt.Sprintf(format, args...)))
+			}
+			if _, err := SortWithOptions([]byte(tc.src), tc.opts); err != nil {
+				t.Fatal(err)
+			}
+			//an empty want is no warning at all
+			var want []string
+			if tc.want != "" {
+				want = []string{tc.want}
+			}
+			if !slices.Equal(warnings, want) {
+				t.Errorf("got %q, want %q", warnings, want)
+			}
+		})
+	}
+}